@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = "usage: gophermart config print [flags]"
+
+// configCommand выполняет подкоманду config и возвращает код выхода.
+// config print выводит итоговую конфигурацию в YAML со скрытыми секретами
+func configCommand(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(errOut, configUsage)
+		return 2
+	}
+	flag, err := utils.LoadConfig(args[1:])
+	if flag.FlagConfigPath != "" {
+		fmt.Fprintf(out, "# config file: %s\n", flag.FlagConfigPath)
+	}
+	data, marshalErr := yaml.Marshal(flag.Masked())
+	if marshalErr != nil {
+		fmt.Fprintln(errOut, marshalErr)
+		return 1
+	}
+	out.Write(data)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
@@ -2,30 +2,129 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/grpcserver"
+	"github.com/Azcarot/GopherMarketProject/internal/health"
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
 	"github.com/Azcarot/GopherMarketProject/internal/router"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/tlsreload"
+	"github.com/Azcarot/GopherMarketProject/internal/tracing"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// shutdownTimeout ограничивает ожидание завершения текущих запросов
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
 	flag := utils.ParseFlagsAndENV()
+	storage.JWTSecret = flag.FlagJWTSecret
+	storage.PointsExpiryMonths = flag.FlagPointsExpiryMonths
+	storage.ExpiringSoonWindow = flag.FlagPointsExpiringWindow
+	storage.Tiers = flag.Tiers()
+	storage.Transfers = storage.TransferLimits{
+		Daily:       int(flag.FlagTransferDailyLimit * 100),
+		ConfirmFrom: int(flag.FlagTransferConfirmFrom * 100),
+		ConfirmTTL:  flag.FlagTransferConfirmTTL,
+		Hold:        flag.FlagTransferHold,
+	}
+	storage.HoldTTL = flag.FlagHoldTTL
+	log, err := logger.New(flag.FlagLogLevel, flag.FlagLogFormat)
+	if err != nil {
+		panic(err)
+	}
+	defer log.Sync()
+	logger.SetDefault(log)
+	if flag.InsecureJWTSecret() {
+		log.Warn("JWT tokens are signed with the default secret, set JWT_SECRET or jwt_secret")
+	}
 	if flag.FlagDBAddr != "" {
-		err := storage.NewConn(flag)
+		shutdownTracing, err := tracing.Setup(context.Background(), flag)
+		if err != nil {
+			panic(err)
+		}
+		defer shutdownTracing(context.Background())
+		err = storage.NewConn(flag)
 		if err != nil {
 			panic(err)
 		}
 		storage.PgxStorage.CreateTablesForGopherStore(storage.ST)
-		defer storage.DB.Close(context.Background())
+		defer storage.DB.Close()
 		r := router.MakeRouter(flag)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var tlsConfig *tls.Config
+		if flag.FlagTLSCert != "" {
+			reloader, err := tlsreload.New(flag.FlagTLSCert, flag.FlagTLSKey)
+			if err != nil {
+				panic(err)
+			}
+			go reloader.Watch(ctx, flag.FlagTLSReloadInterval)
+			tlsConfig, err = tlsreload.ServerConfig(reloader, flag.FlagTLSClientCA)
+			if err != nil {
+				panic(err)
+			}
+		}
+		if flag.FlagGRPCAddr != "" {
+			listener, err := net.Listen("tcp", flag.FlagGRPCAddr)
+			if err != nil {
+				panic(err)
+			}
+			var opts []grpc.ServerOption
+			if tlsConfig != nil {
+				opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig.Clone())))
+			}
+			grpcServer := grpcserver.NewServer(router.RateLimitStore, router.RateLimits(flag), opts...)
+			go grpcServer.Serve(listener)
+			defer grpcServer.GracefulStop()
+		}
 		server := &http.Server{
-			Addr:    flag.FlagAddr,
-			Handler: r,
+			Addr:              flag.FlagAddr,
+			Handler:           r,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: flag.FlagReadHeaderTimeout,
+			ReadTimeout:       flag.FlagReadTimeout,
+			WriteTimeout:      flag.FlagWriteTimeout,
+			IdleTimeout:       flag.FlagIdleTimeout,
+		}
+		go func() {
+			var err error
+			if tlsConfig != nil {
+				// сертификат отдает tlsConfig.GetCertificate, HTTP/2 согласуется через ALPN
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("http server failed", zap.Error(err))
+			}
+		}()
+		<-ctx.Done()
+		// Сначала проваливаем готовность, чтобы балансировщик перестал
+		// присылать новые запросы, затем дожидаемся текущих
+		health.SetShuttingDown()
+		log.Info("shutting down", zap.Duration("delay", flag.FlagShutdownDelay))
+		time.Sleep(flag.FlagShutdownDelay)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("http server shutdown failed", zap.Error(err))
 		}
-		server.ListenAndServe()
 
 	} else {
 		fmt.Fprintf(os.Stderr, "Missing required flag -d : DataBase address\n")
@@ -0,0 +1,203 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State - состояние автоматического выключателя
+type State int
+
+const (
+	// StateClosed - запросы проходят, ошибки подсчитываются
+	StateClosed State = iota
+	// StateHalfOpen - пропускается ограниченное число пробных запросов
+	StateHalfOpen
+	// StateOpen - запросы не отправляются до истечения таймаута
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrOpen возвращается вместо запроса, пока выключатель разомкнут
+var ErrOpen = errors.New("accrual system circuit breaker is open")
+
+// BreakerConfig - пороги выключателя
+type BreakerConfig struct {
+	// FailureThreshold - число ошибок подряд, после которого цепь размыкается
+	FailureThreshold int
+	// OpenTimeout - сколько цепь остается разомкнутой до пробных запросов
+	OpenTimeout time.Duration
+	// HalfOpenProbes - число успешных пробных запросов для замыкания цепи
+	HalfOpenProbes int
+}
+
+// DefaultBreakerConfig используется, если пороги не заданы
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenProbes:   1,
+}
+
+// Breaker - автоматический выключатель (closed/open/half-open)
+// для запросов к системе начислений
+type Breaker struct {
+	mu        sync.Mutex
+	cfg       BreakerConfig
+	state     State
+	failures  int
+	successes int
+	inFlight  int
+	openUntil time.Time
+	// generation растет при каждой смене состояния, результаты
+	// запросов, начатых в прошлых поколениях, не учитываются
+	generation uint64
+
+	now      func() time.Time
+	onChange func(from, to State)
+}
+
+// NewBreaker создает замкнутый выключатель. onChange вызывается
+// под блокировкой при каждой смене состояния и не должен обращаться
+// к выключателю, может быть nil
+func NewBreaker(cfg BreakerConfig, onChange func(from, to State)) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultBreakerConfig.FailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultBreakerConfig.OpenTimeout
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = DefaultBreakerConfig.HalfOpenProbes
+	}
+	return &Breaker{cfg: cfg, now: time.Now, onChange: onChange}
+}
+
+// Allow резервирует право на запрос и возвращает поколение, в котором
+// он начат. После Allow без ошибки нужно вызвать Success или Failure
+// с этим поколением
+func (b *Breaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen {
+		if b.now().Before(b.openUntil) {
+			return 0, ErrOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.inFlight >= b.cfg.HalfOpenProbes {
+			return 0, ErrOpen
+		}
+		b.inFlight++
+	}
+	return b.generation, nil
+}
+
+// Success отмечает успешный запрос поколения gen
+func (b *Breaker) Success(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		b.failures = 0
+	case StateHalfOpen:
+		b.inFlight--
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// Failure отмечает неудачный запрос поколения gen
+func (b *Breaker) Failure(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open(b.cfg.OpenTimeout)
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		b.open(b.cfg.OpenTimeout)
+	}
+}
+
+// Trip размыкает цепь как минимум на d, например по Retry-After.
+// Retry-After действует в любом поколении, gen нужен только для
+// учета пробных запросов
+func (b *Breaker) Trip(gen uint64, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d < b.cfg.OpenTimeout {
+		d = b.cfg.OpenTimeout
+	}
+	if b.state == StateHalfOpen && gen == b.generation {
+		b.inFlight--
+	}
+	b.open(d)
+}
+
+// State возвращает текущее состояние. Разомкнутая цепь с истекшим
+// таймаутом считается полуоткрытой
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.openUntil) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Check - проверка готовности: ошибка, пока цепь разомкнута
+func (b *Breaker) Check(ctx context.Context) error {
+	if b.State() == StateOpen {
+		return ErrOpen
+	}
+	return nil
+}
+
+func (b *Breaker) open(d time.Duration) {
+	until := b.now().Add(d)
+	if b.state == StateOpen && until.Before(b.openUntil) {
+		return
+	}
+	b.openUntil = until
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.successes = 0
+	if state != StateHalfOpen {
+		b.inFlight = 0
+	}
+	if from != state && b.onChange != nil {
+		b.onChange(from, state)
+	}
+}
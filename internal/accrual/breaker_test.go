@@ -0,0 +1,84 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	var transitions []State
+	b := NewBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenProbes: 1},
+		func(from, to State) { transitions = append(transitions, to) })
+	b.now = func() time.Time { return now }
+
+	gen, err := b.Allow()
+	require.NoError(t, err)
+	b.Failure(gen)
+	gen, err = b.Allow()
+	require.NoError(t, err)
+	b.Failure(gen)
+	assert.Equal(t, StateOpen, b.State())
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	now = now.Add(time.Minute)
+	gen, err = b.Allow()
+	require.NoError(t, err, "first probe after the timeout")
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen, "only one probe in half-open")
+	b.Failure(gen)
+	assert.Equal(t, StateOpen, b.State())
+
+	now = now.Add(time.Minute)
+	gen, err = b.Allow()
+	require.NoError(t, err)
+	b.Success(gen)
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.Equal(t, []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, transitions)
+}
+
+func TestBreakerTripHonoursRetryAfter(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{FailureThreshold: 5, OpenTimeout: time.Second, HalfOpenProbes: 1}, nil)
+	b.now = func() time.Time { return now }
+
+	b.Trip(0, time.Minute)
+	now = now.Add(30 * time.Second)
+	_, err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Error(t, b.Check(context.Background()))
+
+	now = now.Add(30 * time.Second)
+	_, err = b.Allow()
+	assert.NoError(t, err)
+}
+
+func TestBreakerIgnoresStaleResults(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenProbes: 1}, nil)
+	b.now = func() time.Time { return now }
+
+	slow, err := b.Allow()
+	require.NoError(t, err)
+	fast, err := b.Allow()
+	require.NoError(t, err)
+	b.Failure(fast)
+	require.Equal(t, StateOpen, b.State())
+
+	b.Success(slow)
+	assert.Equal(t, StateOpen, b.State(), "a request started before the trip does not close the circuit")
+
+	now = now.Add(time.Minute)
+	probe, err := b.Allow()
+	require.NoError(t, err)
+	b.Failure(slow)
+	assert.Equal(t, StateHalfOpen, b.State(), "a stale failure does not reopen the circuit")
+	b.Success(probe)
+	assert.Equal(t, StateClosed, b.State())
+}
@@ -0,0 +1,156 @@
+// Package accrual - клиент системы расчета начислений баллов лояльности
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Статусы расчета начисления
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+// defaultRetryAfter используется, если на 429 не пришел Retry-After
+const defaultRetryAfter = 60 * time.Second
+
+// DefaultTimeout ограничивает один запрос, если таймаут не задан
+const DefaultTimeout = 5 * time.Second
+
+var (
+	// ErrNotRegistered - заказ не зарегистрирован в системе расчета (204)
+	ErrNotRegistered = errors.New("order is not registered in the accrual system")
+	// ErrRateLimited - система расчета просит повторить запрос позже (429)
+	ErrRateLimited = errors.New("accrual system rate limit exceeded")
+)
+
+// Order - ответ системы расчета по заказу
+type Order struct {
+	OrderNumber string  `json:"order"`
+	Status      string  `json:"status"`
+	Accrual     float64 `json:"accrual"`
+}
+
+// Client ходит в систему расчета через автоматический выключатель
+type Client struct {
+	addr    string
+	timeout time.Duration
+	http    *http.Client
+	breaker *Breaker
+}
+
+// NewClient создает клиент системы расчета по адресу addr. Каждый запрос
+// ограничен timeout. Транспорт проставляет traceparent и открывает
+// на каждый запрос клиентский спан
+func NewClient(addr string, timeout time.Duration, cfg BreakerConfig) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		addr:    addr,
+		timeout: timeout,
+		http: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   timeout,
+		},
+		breaker: NewBreaker(cfg, logStateChange),
+	}
+}
+
+// Breaker возвращает выключатель клиента
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// GetOrder запрашивает расчет начисления по заказу. Пока цепь
+// разомкнута, возвращает ErrOpen не обращаясь к системе расчета
+func (c *Client) GetOrder(ctx context.Context, number uint64) (Order, error) {
+	var result Order
+	gen, err := c.breaker.Allow()
+	if err != nil {
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualRejected).Inc()
+		return result, err
+	}
+	// фоновые задачи вызывают клиент с context.Background()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	pth := c.addr + "/api/orders/" + strconv.FormatUint(number, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pth, nil)
+	if err != nil {
+		c.breaker.Success(gen)
+		return result, err
+	}
+	// таймаут тоже считается отказом системы расчета
+	res, err := c.http.Do(req)
+	if err != nil {
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualError).Inc()
+		c.breaker.Failure(gen)
+		return result, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualOK).Inc()
+	case http.StatusNoContent:
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualNotFound).Inc()
+		c.breaker.Success(gen)
+		return result, ErrNotRegistered
+	case http.StatusTooManyRequests:
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualRateLimited).Inc()
+		c.breaker.Trip(gen, retryAfter(res.Header.Get("Retry-After")))
+		return result, ErrRateLimited
+	default:
+		metrics.AccrualRequests.WithLabelValues(metrics.AccrualBadStatus).Inc()
+		if res.StatusCode >= http.StatusInternalServerError {
+			c.breaker.Failure(gen)
+		} else {
+			c.breaker.Success(gen)
+		}
+		return result, fmt.Errorf("accrual system responded with status %d", res.StatusCode)
+	}
+
+	// тело читается под тем же таймаутом, оборванное чтение - отказ
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.breaker.Failure(gen)
+		return result, err
+	}
+	c.breaker.Success(gen)
+	if err = json.Unmarshal(data, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return defaultRetryAfter
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func logStateChange(from, to State) {
+	metrics.AccrualBreakerState.Set(float64(to))
+	metrics.AccrualBreakerTransitions.WithLabelValues(to.String()).Inc()
+	log := logger.Default().With("from", from.String(), "to", to.String())
+	if to == StateOpen {
+		log.Warnw("accrual circuit breaker state changed")
+		return
+	}
+	log.Infow("accrual circuit breaker state changed")
+}
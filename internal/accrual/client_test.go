@@ -0,0 +1,82 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGetOrder(t *testing.T) {
+	status := http.StatusOK
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		assert.Equal(t, "/api/orders/12345678903", req.URL.Path)
+		switch status {
+		case http.StatusOK:
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":500}`))
+		default:
+			res.WriteHeader(status)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	ctx := context.Background()
+
+	order, err := client.GetOrder(ctx, 12345678903)
+	require.NoError(t, err)
+	assert.Equal(t, Order{OrderNumber: "12345678903", Status: StatusProcessed, Accrual: 500}, order)
+
+	status = http.StatusNoContent
+	_, err = client.GetOrder(ctx, 12345678903)
+	assert.ErrorIs(t, err, ErrNotRegistered)
+	assert.Equal(t, StateClosed, client.Breaker().State())
+
+	status = http.StatusInternalServerError
+	_, err = client.GetOrder(ctx, 12345678903)
+	assert.Error(t, err)
+	_, err = client.GetOrder(ctx, 12345678903)
+	assert.Error(t, err)
+	assert.Equal(t, StateOpen, client.Breaker().State())
+
+	_, err = client.GetOrder(ctx, 12345678903)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, 4, calls, "no request is sent while the circuit is open")
+}
+
+func TestClientRateLimitOpensCircuit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Retry-After", "60")
+		res.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, BreakerConfig{FailureThreshold: 5, OpenTimeout: time.Second})
+	_, err := client.GetOrder(context.Background(), 12345678903)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, StateOpen, client.Breaker().State())
+}
+
+func TestClientTimeoutCountsAsFailure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, 50*time.Millisecond, BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	_, err := client.GetOrder(context.Background(), 12345678903)
+	assert.Error(t, err)
+	assert.Equal(t, StateOpen, client.Breaker().State())
+}
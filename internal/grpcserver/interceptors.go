@@ -0,0 +1,136 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/Azcarot/GopherMarketProject/internal/middleware"
+	pb "github.com/Azcarot/GopherMarketProject/internal/proto"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const authMetadataKey = "authorization"
+
+// publicMethods не требуют аутентификации
+var publicMethods = map[string]bool{
+	pb.Gophermart_Register_FullMethodName: true,
+	pb.Gophermart_Login_FullMethodName:    true,
+}
+
+// AuthInterceptor проверяет JWT-токен из метаданных так же, как
+// middleware.CheckAuthorization, и кладет логин пользователя в контекст
+func AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authMetadataKey); len(values) > 0 {
+			token = values[0]
+		}
+	}
+	login, err := storage.Authenticate(token)
+	if errors.Is(err, storage.ErrUnauthorized) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	ctx = logger.With(ctx, "login", login)
+	return handler(context.WithValue(ctx, storage.UserLoginCtxKey, login), req)
+}
+
+// limitedMethods - методы без аутентификации и HTTP-маршруты, с которыми
+// они делят лимит и корзины, чтобы подбор пароля нельзя было
+// распределить между двумя API
+var limitedMethods = map[string]string{
+	pb.Gophermart_Register_FullMethodName: middleware.RouteKey(http.MethodPost, "/api/user/register"),
+	pb.Gophermart_Login_FullMethodName:    middleware.RouteKey(http.MethodPost, "/api/user/login"),
+}
+
+// RateLimitInterceptor ограничивает частоту вызовов входа и регистрации
+// по IP клиента так же, как middleware.RateLimit. Лимит берется из table
+// по маршруту из limitedMethods. При отказе возвращается ResourceExhausted
+// с заголовком retry-after. Если хранилище недоступно, вызов пропускается
+func RateLimitInterceptor(store ratelimit.Store, table map[string]ratelimit.Limit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		route, ok := limitedMethods[info.FullMethod]
+		limit := table[route]
+		if !ok || !limit.Enabled() {
+			return handler(ctx, req)
+		}
+		result, err := store.Take(ctx, route+" ip:"+peerHost(ctx), limit)
+		if err != nil {
+			logger.FromContext(ctx).Warnw("rate limit store failed", "error", err)
+			return handler(ctx, req)
+		}
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(info.FullMethod).Inc()
+			retryAfter := strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests, retry after "+retryAfter+" seconds")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// peerHost - IP клиента без порта
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// DefaultTimeout - дедлайн вызова, если клиент не передал свой
+var DefaultTimeout = 5 * time.Second
+
+// DeadlineInterceptor ограничивает время вызова, сохраняя более
+// короткий дедлайн клиента
+func DeadlineInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	return handler(ctx, req)
+}
+
+// LoggingInterceptor кладет в контекст логгер вызова и пишет в лог
+// сведения о каждом вызове. Должен стоять перед AuthInterceptor
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = logger.With(ctx, "grpc_method", info.FullMethod)
+	resp, err := handler(ctx, req)
+	logger.FromContext(ctx).Infow("grpc call",
+		"code", status.Code(err),
+		"duration", time.Since(start),
+	)
+	return resp, err
+}
+
+// storageError скрывает от клиента текст ошибки хранилища
+func storageError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, "the request took too long to process")
+	}
+	return status.Error(codes.Internal, "the request could not be processed")
+}
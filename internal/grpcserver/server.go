@@ -0,0 +1,181 @@
+// Package grpcserver реализует gRPC API накопительной системы поверх
+// того же хранилища и той же аутентификации, что и HTTP API
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	pb "github.com/Azcarot/GopherMarketProject/internal/proto"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	pb.UnimplementedGophermartServer
+}
+
+// NewServer создает gRPC-сервер с интерсепторами логирования, ограничения
+// частоты и аутентификации. Корзины берутся из store, лимиты - из limits
+// по RouteKey HTTP-маршрутов. Дополнительные опции (например, TLS)
+// передаются в grpc.NewServer
+func NewServer(store ratelimit.Store, limits map[string]ratelimit.Limit, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(LoggingInterceptor, DeadlineInterceptor,
+		RateLimitInterceptor(store, limits), AuthInterceptor))
+	s := grpc.NewServer(opts...)
+	pb.RegisterGophermartServer(s, &Server{})
+	return s
+}
+
+func (s *Server) Register(ctx context.Context, in *pb.Credentials) (*pb.AuthResponse, error) {
+	userData := storage.UserData{
+		Login:    in.GetLogin(),
+		Password: in.GetPassword(),
+		Date:     time.Now().Format(time.RFC3339),
+	}
+	exists, err := storage.PgxStorage.CheckUserExists(storage.ST, userData)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if exists {
+		return nil, status.Error(codes.AlreadyExists, "login is already taken")
+	}
+	if err = storage.PgxStorage.CreateNewUser(storage.ST, ctx, userData); err != nil {
+		return nil, storageError(err)
+	}
+	token, err := storage.NewToken(userData.Login)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.AuthResponse{Token: token}, nil
+}
+
+func (s *Server) Login(ctx context.Context, in *pb.Credentials) (*pb.AuthResponse, error) {
+	userData := storage.UserData{Login: in.GetLogin(), Password: in.GetPassword()}
+	ok, err := storage.PgxStorage.CheckUserPassword(storage.ST, ctx, userData)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, storageError(err)
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid login or password")
+	}
+	token, err := storage.NewToken(userData.Login)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.AuthResponse{Token: token}, nil
+}
+
+func (s *Server) UploadOrder(ctx context.Context, in *pb.UploadOrderRequest) (*pb.UploadOrderResponse, error) {
+	orderNumber, err := utils.ParseOrderNumber(in.GetNumber())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "order number must consist of digits only")
+	}
+	if !utils.IsOrderNumberValid(orderNumber) {
+		return nil, status.Error(codes.InvalidArgument, "order number fails the Luhn check")
+	}
+	order := storage.OrderData{OrderNumber: orderNumber}
+	isNew, anotherUser, err := storage.PgxStorage.CheckIfOrderExists(storage.ST, ctx, order)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, storageError(err)
+	}
+	if anotherUser {
+		return nil, status.Error(codes.AlreadyExists, "order has already been uploaded by another user")
+	}
+	if !isNew {
+		return &pb.UploadOrderResponse{Status: pb.UploadOrderResponse_ALREADY_UPLOADED}, nil
+	}
+	order.Date = time.Now().Format(time.RFC3339)
+	err = storage.PgxStorage.CreateNewOrder(storage.ST, ctx, order)
+	if errors.Is(err, storage.ErrOrderExists) {
+		_, anotherUser, err = storage.PgxStorage.CheckIfOrderExists(storage.ST, ctx, order)
+		if err != nil {
+			return nil, storageError(err)
+		}
+		if anotherUser {
+			return nil, status.Error(codes.AlreadyExists, "order has already been uploaded by another user")
+		}
+		return &pb.UploadOrderResponse{Status: pb.UploadOrderResponse_ALREADY_UPLOADED}, nil
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.UploadOrderResponse{Status: pb.UploadOrderResponse_ACCEPTED}, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, in *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	orders, err := storage.PgxStorage.GetCustomerOrders(storage.ST, ctx)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	result := &pb.ListOrdersResponse{}
+	for _, order := range orders {
+		result.Orders = append(result.Orders, &pb.Order{
+			Number:     order.OrderNumber,
+			Status:     order.State,
+			Accrual:    order.Accrual,
+			UploadedAt: order.Date,
+		})
+	}
+	return result, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, in *pb.GetBalanceRequest) (*pb.Balance, error) {
+	login, _ := ctx.Value(storage.UserLoginCtxKey).(string)
+	balance, err := storage.PgxStorage.GetUserBalance(storage.ST, ctx, storage.UserData{Login: login})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Balance{
+		Current:   balance.Accrual / 100,
+		Withdrawn: balance.Withdrawn / 100,
+	}, nil
+}
+
+func (s *Server) Withdraw(ctx context.Context, in *pb.WithdrawRequest) (*pb.WithdrawResponse, error) {
+	login, _ := ctx.Value(storage.UserLoginCtxKey).(string)
+	orderNumber, err := utils.ParseOrderNumber(in.GetOrder())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "order number must consist of digits only")
+	}
+	if !utils.IsOrderNumberValid(orderNumber) {
+		return nil, status.Error(codes.InvalidArgument, "order number fails the Luhn check")
+	}
+	if storage.Cents(in.GetSum()) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "sum must be at least 0.01")
+	}
+	ctx = context.WithValue(ctx, storage.OrderNumberCtxKey, orderNumber)
+	withdrawal := storage.WithdrawRequest{OrderNumber: in.GetOrder(), Amount: in.GetSum()}
+	result, err := storage.PgxStorage.WithdrawFromUser(storage.ST, ctx, withdrawal)
+	if errors.Is(err, storage.ErrInsufficientFunds) {
+		return nil, status.Error(codes.FailedPrecondition, "not enough points on the balance")
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	notify.PublishWithdrawal(ctx, login, result)
+	return &pb.WithdrawResponse{}, nil
+}
+
+func (s *Server) ListWithdrawals(ctx context.Context, in *pb.ListWithdrawalsRequest) (*pb.ListWithdrawalsResponse, error) {
+	withdrawals, err := storage.PgxStorage.GetWithdrawals(storage.ST, ctx)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	result := &pb.ListWithdrawalsResponse{}
+	for _, withdrawal := range withdrawals {
+		result.Withdrawals = append(result.Withdrawals, &pb.Withdrawal{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Amount,
+			ProcessedAt: withdrawal.ProcessedAt,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	pb "github.com/Azcarot/GopherMarketProject/internal/proto"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, interceptors ...grpc.UnaryServerInterceptor) pb.GophermartClient {
+	if len(interceptors) == 0 {
+		interceptors = []grpc.UnaryServerInterceptor{AuthInterceptor}
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	pb.RegisterGophermartServer(server, &Server{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGophermartClient(conn)
+}
+
+func TestGetBalanceRequiresToken(t *testing.T) {
+	client := newTestClient(t)
+	_, err := client.GetBalance(context.Background(), &pb.GetBalanceRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGetBalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+	mock.EXPECT().CheckUserExists(storage.UserData{Login: "user"}).Return(true, nil)
+	mock.EXPECT().GetUserBalance(gomock.Any(), storage.UserData{Login: "user"}).
+		Return(storage.BalanceResponce{Accrual: 50050, Withdrawn: 4200}, nil)
+
+	token, err := storage.NewToken("user")
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authMetadataKey, token)
+	client := newTestClient(t)
+	balance, err := client.GetBalance(ctx, &pb.GetBalanceRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 500.5, balance.GetCurrent())
+	require.Equal(t, 42.0, balance.GetWithdrawn())
+}
+
+func TestWithdrawRejectsSumRoundingToZero(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+	mock.EXPECT().CheckUserExists(storage.UserData{Login: "user"}).Return(true, nil)
+
+	token, err := storage.NewToken("user")
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authMetadataKey, token)
+	client := newTestClient(t)
+	_, err = client.Withdraw(ctx, &pb.WithdrawRequest{Order: "2377225624", Sum: 0.004})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+	mock.EXPECT().CheckUserPassword(gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
+	mock.EXPECT().CheckUserExists(gomock.Any()).Return(true, nil)
+
+	table := map[string]ratelimit.Limit{
+		limitedMethods[pb.Gophermart_Login_FullMethodName]: {Requests: 2, Period: time.Minute},
+	}
+	client := newTestClient(t, RateLimitInterceptor(ratelimit.NewMemoryStore(), table), AuthInterceptor)
+	ctx := context.Background()
+	credentials := &pb.Credentials{Login: "user", Password: "wrong"}
+	for i := 0; i < 2; i++ {
+		_, err := client.Login(ctx, credentials)
+		require.Equal(t, codes.Unauthenticated, status.Code(err), "attempt %d must reach the handler", i+1)
+	}
+	var header metadata.MD
+	_, err := client.Login(ctx, credentials, grpc.Header(&header))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.NotEmpty(t, header.Get("retry-after"))
+
+	_, err = client.Register(ctx, credentials)
+	require.Equal(t, codes.AlreadyExists, status.Code(err), "register has its own bucket and no limit in the table")
+}
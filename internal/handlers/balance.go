@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
 )
 
@@ -12,24 +13,26 @@ func GetBalance(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	data, ok := ctx.Value(storage.UserLoginCtxKey).(string)
 	if !ok {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, storage.ErrNoLogin)
 		return
 	}
 	userData.Login = data
 	var balanceData storage.BalanceResponce
 	balanceData, err := storage.PgxStorage.GetUserBalance(storage.ST, ctx, userData)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
 	balanceData.Accrual = balanceData.Accrual / 100
 	balanceData.Withdrawn = balanceData.Withdrawn / 100
+	balanceData.ExpiringSoon = balanceData.ExpiringSoon / 100
+	balanceData.Debt = balanceData.Debt / 100
+	balanceData.Held = balanceData.Held / 100
+	balanceData.Available = balanceData.Available / 100
 	result, err := json.Marshal(balanceData)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
-	res.Header().Add("Content-Type", "application/json")
-	res.WriteHeader(http.StatusOK)
-	res.Write(result)
+	writeJSONWithETag(res, req, result)
 }
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+)
+
+// readBody читает тело запроса и сам отвечает клиенту, если это не удалось.
+// Превышение лимита middleware.LimitBody превращается в 413
+func readBody(res http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(req.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		problem.Error(res, req, http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge,
+			"request body must not exceed "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return nil, false
+	}
+	if err != nil {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "request body could not be read")
+		return nil, false
+	}
+	return data, true
+}
+
+// queryInt читает целый параметр запроса name в пределах [low, high]
+// и сам отвечает клиенту 400, если значение некорректно
+func queryInt(res http.ResponseWriter, req *http.Request, name string, def, low, high int64) (int64, bool) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < low || n > high {
+		problem.Write(res, req, problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: name, Code: "out_of_range",
+				Detail: name + " must be between " + strconv.FormatInt(low, 10) + " and " + strconv.FormatInt(high, 10)}))
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// ExpirePoints списывает сгоревшие баллы и отправляет пользователям новый баланс
+func ExpirePoints() {
+	ctx := context.Background()
+	expired, err := storage.PgxStorage.ExpirePoints(storage.ST, ctx)
+	if err != nil {
+		logger.Default().Errorw("failed to expire points", "error", err)
+		return
+	}
+	notified := make(map[string]bool)
+	for _, e := range expired {
+		metrics.PointsExpired.Add(e.Amount)
+		if !notified[e.Login] {
+			notified[e.Login] = true
+			notify.PublishBalance(ctx, e.Login)
+		}
+	}
+}
+
+// GetExpirations возвращает историю сгоревших баллов пользователя
+func GetExpirations(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	expirations, err := storage.PgxStorage.GetExpirations(storage.ST, ctx)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(expirations) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(expirations)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	writeJSONWithETag(res, req, result)
+}
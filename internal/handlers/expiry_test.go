@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetExpirations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/balance/expirations", nil)
+		req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(GetExpirations).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	mock.EXPECT().GetExpirations(gomock.Any()).Return(nil, nil)
+	require.Equal(t, http.StatusNoContent, serve().Code)
+
+	mock.EXPECT().GetExpirations(gomock.Any()).Return([]storage.ExpirationResponse{{
+		Login:       "user",
+		OrderNumber: "9278923470",
+		Amount:      12.5,
+		AccruedAt:   "2025-01-10T15:15:45Z",
+		ExpiredAt:   "2026-01-10T15:15:45Z",
+	}}, nil)
+	res := serve()
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `[{"order":"9278923470","sum":12.5,"accrued_at":"2025-01-10T15:15:45Z","expired_at":"2026-01-10T15:15:45Z"}]`, res.Body.String())
+}
@@ -1,89 +1,59 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
-	"io"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/accrual"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
-	"github.com/Azcarot/GopherMarketProject/internal/utils"
-	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func GetOrders(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	_, ok := req.Context().Value(storage.UserLoginCtxKey).(string)
 	if !ok {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, storage.ErrNoLogin)
 		return
 	}
 	orders, err := storage.PgxStorage.GetCustomerOrders(storage.ST, ctx)
-	if errors.Is(err, pgx.ErrNoRows) {
-		res.WriteHeader(http.StatusNoContent)
+	if err != nil {
+		problem.Internal(res, req, err)
 		return
 	}
-	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+	if len(orders) == 0 {
+		res.WriteHeader(http.StatusNoContent)
 		return
 	}
 	result, err := json.Marshal(orders)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
-	res.Header().Add("Content-Type", "application/json")
-	res.WriteHeader(http.StatusOK)
-	res.Write(result)
+	writeJSONWithETag(res, req, result)
 
 }
 
-func GetOrderData(flag utils.Flags, order uint64) (OrderRequest, error) {
-	pth := flag.FlagAccrualAddr + "/api/orders/" + strconv.Itoa(int(order))
-	var b []byte
-	result := OrderRequest{}
-	resp, err := http.NewRequest("GET", pth, bytes.NewBuffer(b))
-	if err != nil {
-		return result, err
-	}
+// Accrual - клиент системы расчета, используется фоновым опросом заказов
+var Accrual *accrual.Client
 
-	var res *http.Response
-	res, err = CheckStatus(resp)
-	if err != nil {
-		return result, err
-	}
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		return result, err
-	}
-	defer res.Body.Close()
-
-	if err = json.Unmarshal(data, &result); err != nil {
-		return result, err
-	}
-	return result, err
-}
-
-func CheckStatus(resp *http.Request) (*http.Response, error) {
-	client := &http.Client{}
-	res, err := client.Do(resp)
-	if err != nil {
-		return res, err
-	}
-	if res.StatusCode == http.StatusTooManyRequests {
-		time.Sleep(time.Duration(1 * time.Second))
-		res, _ = CheckStatus(resp)
+var tracer = otel.Tracer("github.com/Azcarot/GopherMarketProject/internal/handlers")
 
+// ActualiseOrders запрашивает у системы расчета статусы незавершенных
+// заказов. Пока выключатель клиента разомкнут, опрос пропускается целиком
+func ActualiseOrders() {
+	if Accrual.Breaker().State() == accrual.StateOpen {
+		return
 	}
-	return res, err
-}
-
-func ActualiseOrders(flag utils.Flags) {
 	orderNumbers, err := storage.PgxStorage.GetUnfinishedOrders(storage.ST)
 	ctx := context.Background()
 	if err != nil {
@@ -93,20 +63,22 @@ func ActualiseOrders(flag utils.Flags) {
 			return
 		}
 	}
+	metrics.UnfinishedOrders.Set(float64(len(orderNumbers)))
 	var wg sync.WaitGroup
-	for i, order := range orderNumbers {
-		ind := i
-		ord := order
+	for _, order := range orderNumbers {
 		wg.Add(1)
-		go func(int, uint64) {
+		go func(ord storage.OrderData) {
 			defer wg.Done()
-			orderReq, err := GetOrderData(flag, ord)
+			ctx, span := tracer.Start(ctx, "ActualiseOrder",
+				trace.WithAttributes(attribute.String("order.number", strconv.FormatUint(ord.OrderNumber, 10))))
+			defer span.End()
+			orderReq, err := Accrual.GetOrder(ctx, ord.OrderNumber)
 			if err != nil {
 				return
 			}
-			if (orderReq.Status != "NEW") && (orderReq.Status != "PROCESSING") {
+			if (orderReq.Status != accrual.StatusRegistered) && (orderReq.Status != accrual.StatusProcessing) {
 				var orderData storage.OrderData
-				orderData.Accrual = int(orderReq.Accrual * 100)
+				orderData.Accrual = storage.Cents(orderReq.Accrual)
 				orderNumber, err := strconv.Atoi(orderReq.OrderNumber)
 				if err != nil {
 					return
@@ -117,19 +89,20 @@ func ActualiseOrders(flag utils.Flags) {
 				if err != nil {
 					return
 				}
+				notify.Default.Publish(ord.User, notify.OrderUpdated, storage.OrderResponse{
+					OrderNumber: orderReq.OrderNumber,
+					Accrual:     orderReq.Accrual,
+					State:       orderReq.Status,
+				})
 				if orderData.Accrual > 0 {
 					_, err := storage.PgxStorage.AddBalanceToUser(storage.ST, orderData)
 					if err != nil {
 						return
 					}
+					notify.PublishBalance(ctx, ord.User)
 				}
-				orderNumbers[ind] = orderNumbers[len(orderNumbers)-1]
-				orderNumbers = orderNumbers[:len(orderNumbers)-1]
-			}
-			if len(orderNumbers) == 0 {
-				return
 			}
-		}(ind, ord)
+		}(order)
 	}
 	wg.Wait()
 
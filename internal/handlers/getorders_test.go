@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/accrual"
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrders(t *testing.T) {
+	orders := []storage.OrderResponse{
+		{OrderNumber: "9278923470", Accrual: 500, State: "PROCESSED", Date: "2020-12-10T15:15:45+03:00"},
+	}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+
+	serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(GetOrders).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	mock.EXPECT().GetCustomerOrders(gomock.Any()).Return([]storage.OrderResponse{}, nil)
+	require.Equal(t, http.StatusNoContent, serve("").Code)
+
+	mock.EXPECT().GetCustomerOrders(gomock.Any()).Return(orders, nil).Times(3)
+	first := serve("")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	notModified := serve(etag)
+	require.Equal(t, http.StatusNotModified, notModified.Code)
+	require.Empty(t, notModified.Body.Bytes())
+
+	require.Equal(t, http.StatusOK, serve(`"stale"`).Code)
+}
+
+func TestActualiseOrders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		number := strings.TrimPrefix(req.URL.Path, "/api/orders/")
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"order":"` + number + `","status":"PROCESSED","accrual":7.29}`))
+	}))
+	defer server.Close()
+	Accrual = accrual.NewClient(server.URL, 0, accrual.BreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute})
+	notify.Default = notify.NewHub(notify.DefaultMaxConnsPerUser, notify.DefaultBufferSize)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+
+	orders := make([]storage.OrderData, 0, 20)
+	for i := 0; i < 20; i++ {
+		orders = append(orders, storage.OrderData{OrderNumber: uint64(1000 + i), User: "user", State: "NEW"})
+	}
+	var mu sync.Mutex
+	updated := map[uint64]int{}
+	mock.EXPECT().GetUnfinishedOrders().Return(orders, nil)
+	mock.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, data storage.OrderData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		updated[data.OrderNumber] = data.Accrual
+		return nil
+	}).Times(len(orders))
+	mock.EXPECT().AddBalanceToUser(gomock.Any()).Return(true, nil).Times(len(orders))
+
+	ActualiseOrders()
+
+	require.Len(t, updated, len(orders), "every order must be polled exactly once")
+	for _, order := range orders {
+		require.Equal(t, 729, updated[order.OrderNumber], "accrual must be rounded to cents")
+	}
+}
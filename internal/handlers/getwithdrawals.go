@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
 )
 
@@ -11,20 +12,22 @@ func GetWithdrawals(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	_, ok := req.Context().Value(storage.UserLoginCtxKey).(string)
 	if !ok {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, storage.ErrNoLogin)
 		return
 	}
 	withdrawals, err := storage.PgxStorage.GetWithdrawals(storage.ST, ctx)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(withdrawals) == 0 {
+		res.WriteHeader(http.StatusNoContent)
 		return
 	}
 	result, err := json.Marshal(withdrawals)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
-	res.Header().Add("Content-Type", "application/json")
-	res.WriteHeader(http.StatusOK)
-	res.Write(result)
+	writeJSONWithETag(res, req, result)
 }
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateHold резервирует баллы под будущее списание в счет заказа,
+// например при открытии корзины. Резерв действует storage.HoldTTL
+func CreateHold(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	var hold storage.HoldRequest
+	if err := json.Unmarshal(data, &hold); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	orderNumber, err := utils.ParseOrderNumber(hold.OrderNumber)
+	if err != nil {
+		problem.Write(res, req, problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "order", Code: "not_a_number", Detail: "order number must consist of digits only"}))
+		return
+	}
+	if !utils.IsOrderNumberValid(orderNumber) {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "order number fails the Luhn check").
+			WithErrors(problem.FieldError{Field: "order", Code: "invalid_luhn"}))
+		return
+	}
+	// сумма проверяется в копейках: 0.004 округляется до нуля
+	if storage.Cents(hold.Amount) <= 0 {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "sum", Code: "not_positive", Detail: "sum must be at least 0.01"}))
+		return
+	}
+	result, err := storage.PgxStorage.CreateHold(storage.ST, ctx, hold)
+	if err != nil {
+		holdError(res, req, err)
+		return
+	}
+	notify.PublishBalance(ctx, dataLogin)
+	writeHold(res, req, http.StatusCreated, result)
+}
+
+// CaptureHold списывает зарезервированные баллы, например после оплаты
+func CaptureHold(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := holdID(res, req)
+	if !ok {
+		return
+	}
+	withdrawal, err := storage.PgxStorage.CaptureHold(storage.ST, ctx, id)
+	if err != nil {
+		holdError(res, req, err)
+		return
+	}
+	notify.PublishWithdrawal(ctx, withdrawal.Login, withdrawal)
+	result, err := json.Marshal(withdrawal)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(result)
+}
+
+// ReleaseHold снимает резерв, например при закрытии корзины без оплаты
+func ReleaseHold(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := holdID(res, req)
+	if !ok {
+		return
+	}
+	result, err := storage.PgxStorage.ReleaseHold(storage.ST, ctx, id)
+	if err != nil {
+		holdError(res, req, err)
+		return
+	}
+	notify.PublishBalance(ctx, result.Login)
+	writeHold(res, req, http.StatusOK, result)
+}
+
+// ReleaseExpiredHolds снимает просроченные резервы и отправляет
+// пользователям новый баланс
+func ReleaseExpiredHolds() {
+	ctx := context.Background()
+	expired, err := storage.PgxStorage.ReleaseExpiredHolds(storage.ST, ctx)
+	if err != nil {
+		logger.Default().Errorw("failed to release expired holds", "error", err)
+		return
+	}
+	notified := make(map[string]bool)
+	for _, hold := range expired {
+		if !notified[hold.Login] {
+			notified[hold.Login] = true
+			notify.PublishBalance(ctx, hold.Login)
+		}
+	}
+}
+
+func holdID(res http.ResponseWriter, req *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "hold id must be a number")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeHold(res http.ResponseWriter, req *http.Request, status int, hold storage.HoldResponse) {
+	result, err := json.Marshal(hold)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(result)
+}
+
+// holdError отвечает на ошибки резерва
+func holdError(res http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		problem.Error(res, req, http.StatusPaymentRequired, problem.CodeInsufficientFunds, "not enough available points on the balance")
+	case errors.Is(err, storage.ErrHoldNotFound):
+		problem.Error(res, req, http.StatusNotFound, problem.CodeNotFound, "hold not found")
+	case errors.Is(err, storage.ErrHoldExpired):
+		problem.Error(res, req, http.StatusGone, problem.CodeHoldExpired, "the hold has expired")
+	case errors.Is(err, storage.ErrHoldExists):
+		problem.Error(res, req, http.StatusConflict, problem.CodeHoldExists, "the order already has an active hold")
+	case errors.Is(err, storage.ErrHoldNotActive):
+		problem.Error(res, req, http.StatusConflict, problem.CodeHoldNotActive, "the hold is already captured or released")
+	default:
+		problem.Internal(res, req, err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolds(t *testing.T) {
+	notify.Default = notify.NewHub(notify.DefaultMaxConnsPerUser, notify.DefaultBufferSize)
+	hold := storage.HoldResponse{ID: 7, Login: "user", OrderNumber: "2377225624", Amount: 100, State: storage.HoldActive}
+	tests := []struct {
+		name      string
+		url       string
+		body      string
+		setup     func(mock *mock_storage.MockPgxStorage)
+		expStatus int
+		expCode   string
+	}{
+		{"create", "/balance/holds", `{"order":"2377225624","sum":100}`, func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().CreateHold(gomock.Any(), storage.HoldRequest{OrderNumber: "2377225624", Amount: 100}).Return(hold, nil)
+		}, http.StatusCreated, ""},
+		{"create bad luhn", "/balance/holds", `{"order":"12345","sum":100}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber},
+		{"create zero sum", "/balance/holds", `{"order":"2377225624","sum":0}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"create sum rounding to zero", "/balance/holds", `{"order":"2377225624","sum":0.004}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"create over available", "/balance/holds", `{"order":"2377225624","sum":100}`, func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().CreateHold(gomock.Any(), gomock.Any()).Return(storage.HoldResponse{}, storage.ErrInsufficientFunds)
+		}, http.StatusPaymentRequired, problem.CodeInsufficientFunds},
+		{"create second hold on the order", "/balance/holds", `{"order":"2377225624","sum":100}`, func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().CreateHold(gomock.Any(), gomock.Any()).Return(storage.HoldResponse{}, storage.ErrHoldExists)
+		}, http.StatusConflict, problem.CodeHoldExists},
+		{"capture", "/balance/holds/7/capture", "", func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().CaptureHold(gomock.Any(), int64(7)).Return(storage.WithdrawResponse{Login: "user", OrderNumber: "2377225624", Amount: 100}, nil)
+		}, http.StatusOK, ""},
+		{"capture expired", "/balance/holds/7/capture", "", func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().CaptureHold(gomock.Any(), int64(7)).Return(storage.WithdrawResponse{}, storage.ErrHoldExpired)
+		}, http.StatusGone, problem.CodeHoldExpired},
+		{"release", "/balance/holds/7/release", "", func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().ReleaseHold(gomock.Any(), int64(7)).Return(hold, nil)
+		}, http.StatusOK, ""},
+		{"release captured", "/balance/holds/7/release", "", func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().ReleaseHold(gomock.Any(), int64(7)).Return(storage.HoldResponse{}, storage.ErrHoldNotActive)
+		}, http.StatusConflict, problem.CodeHoldNotActive},
+		{"release unknown", "/balance/holds/8/release", "", func(mock *mock_storage.MockPgxStorage) {
+			mock.EXPECT().ReleaseHold(gomock.Any(), int64(8)).Return(storage.HoldResponse{}, storage.ErrHoldNotFound)
+		}, http.StatusNotFound, problem.CodeNotFound},
+		{"bad id", "/balance/holds/x/release", "", nil, http.StatusBadRequest, problem.CodeInvalidRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			if test.setup != nil {
+				test.setup(mock)
+			}
+			r := chi.NewRouter()
+			r.Post("/balance/holds", CreateHold)
+			r.Post("/balance/holds/{id}/capture", CaptureHold)
+			r.Post("/balance/holds/{id}/release", ReleaseHold)
+			req := httptest.NewRequest(http.MethodPost, test.url, strings.NewReader(test.body))
+			req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expCode == "" {
+				return
+			}
+			var details problem.Details
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			require.Equal(t, test.expCode, details.Code)
+		})
+	}
+}
@@ -2,12 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
-	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
-	"github.com/golang-jwt/jwt"
+	"github.com/jackc/pgx/v5"
 )
 
 // Структура HTTP-запроса на вход в аккаунт
@@ -22,54 +22,40 @@ type LoginResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
-var jwtSecretKey = []byte(storage.SecretKey)
-
 func LoginUser(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			loginData := LoginRequest{}
-			data, err := io.ReadAll(req.Body)
-			if err != nil {
-				res.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			if err = json.Unmarshal(data, &loginData); err != nil {
-				res.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			var userData storage.UserData
-			userData.Login = loginData.Login
-			userData.Password = loginData.Password
-			result, err := storage.PgxStorage.CheckUserPassword(storage.ST, ctx, userData)
-			if err != nil {
-				res.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			if !result {
-				res.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			payload := jwt.MapClaims{
-				"sub": loginData.Login,
-				"exp": time.Now().Add(time.Hour * 72).Unix(),
-			}
-
-			// Создаем новый JWT-токен и подписываем его по алгоритму HS256
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-
-			authToken, err := token.SignedString(jwtSecretKey)
-			if err != nil {
-				res.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			res.Header().Add("Authorization", authToken)
-
-			res.WriteHeader(http.StatusOK)
-
-		}
+	loginData := LoginRequest{}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(data, &loginData); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
 	}
+	var userData storage.UserData
+	userData.Login = loginData.Login
+	userData.Password = loginData.Password
+	result, err := storage.PgxStorage.CheckUserPassword(storage.ST, ctx, userData)
+	if errors.Is(err, pgx.ErrNoRows) {
+		problem.Error(res, req, http.StatusUnauthorized, problem.CodeInvalidCredentials, "invalid login or password")
+		return
+	}
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if !result {
+		problem.Error(res, req, http.StatusUnauthorized, problem.CodeInvalidCredentials, "invalid login or password")
+		return
+	}
+	authToken, err := storage.NewToken(loginData.Login)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Authorization", authToken)
+
+	res.WriteHeader(http.StatusOK)
+	return
 }
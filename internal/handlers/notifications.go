@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = (wsPongWait * 9) / 10
+	wsMaxMessageSize = 512
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Notifications открывает WebSocket-соединение, по которому пользователю
+// отправляются события об изменении баланса, заказов и списаний
+func Notifications(res http.ResponseWriter, req *http.Request) {
+	login, ok := req.Context().Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	sub, err := notify.Default.Subscribe(login)
+	if errors.Is(err, notify.ErrTooManyConnections) {
+		problem.Error(res, req, http.StatusTooManyRequests, problem.CodeTooManyConnections, "too many notification connections for the user")
+		return
+	}
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	defer notify.Default.Unsubscribe(login, sub)
+	conn, err := upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту ошибкой
+		return
+	}
+	defer conn.Close()
+	go wsWritePump(conn, sub)
+	wsReadPump(conn)
+}
+
+// wsReadPump вычитывает входящие сообщения, чтобы обрабатывать pong и close,
+// и завершается при разрыве соединения
+func wsReadPump(conn *websocket.Conn) {
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// wsWritePump отправляет события подписчика и периодические ping
+func wsWritePump(conn *websocket.Conn, sub *notify.Subscriber) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case event := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-sub.Done():
+			code, text := websocket.CloseNormalClosure, ""
+			if sub.Overflowed() {
+				code, text = websocket.CloseTryAgainLater, "client is too slow"
+			}
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
@@ -2,46 +2,39 @@ package handlers
 
 import (
 	"errors"
-	"io"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/jackc/pgx/v5"
 )
 
-type OrderRequest struct {
-	OrderNumber string  `json:"order"`
-	Status      string  `json:"status"`
-	Accrual     float64 `json:"accrual"`
-}
-
 func Order(res http.ResponseWriter, req *http.Request) {
 	var userData storage.UserData
 	ctx := req.Context()
 	dataLogin, ok := req.Context().Value(storage.UserLoginCtxKey).(string)
 	if !ok {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, storage.ErrNoLogin)
 		return
 	}
 	userData.Login = dataLogin
-	data, err := io.ReadAll(req.Body)
-	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+	data, ok := readBody(res, req)
+	if !ok {
 		return
 	}
 	asString := string(data)
 
-	orderNumber, err := strconv.ParseUint(asString, 10, 64)
+	orderNumber, err := utils.ParseOrderNumber(asString)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "order number must consist of digits only")
 		return
 	}
 	ok = utils.IsOrderNumberValid(orderNumber)
 	if !ok {
-		res.WriteHeader(http.StatusUnprocessableEntity)
+		problem.Error(res, req, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "order number fails the Luhn check")
 		return
 	}
 	var order storage.OrderData
@@ -51,12 +44,13 @@ func Order(res http.ResponseWriter, req *http.Request) {
 	mut.Lock()
 	defer mut.Unlock()
 	ok, anotherUser, err := storage.PgxStorage.CheckIfOrderExists(storage.ST, ctx, order)
-	if errors.Is(err, storage.ErrNoLogin) {
-		res.WriteHeader(http.StatusInternalServerError)
+	// ErrNoRows значит, что заказа еще нет, остальные ошибки - сбой базы
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		problem.Internal(res, req, err)
 		return
 	}
 	if anotherUser {
-		res.WriteHeader(http.StatusConflict)
+		problem.Error(res, req, http.StatusConflict, problem.CodeOrderConflict, "order has already been uploaded by another user")
 		return
 	}
 	if !ok {
@@ -65,8 +59,21 @@ func Order(res http.ResponseWriter, req *http.Request) {
 	}
 	order.Date = time.Now().Format(time.RFC3339)
 	err = storage.PgxStorage.CreateNewOrder(storage.ST, ctx, order)
+	if errors.Is(err, storage.ErrOrderExists) {
+		// параллельный запрос загрузил тот же номер между проверкой и вставкой
+		_, anotherUser, err = storage.PgxStorage.CheckIfOrderExists(storage.ST, ctx, order)
+		switch {
+		case err != nil:
+			problem.Internal(res, req, err)
+		case anotherUser:
+			problem.Error(res, req, http.StatusConflict, problem.CodeOrderConflict, "order has already been uploaded by another user")
+		default:
+			res.WriteHeader(http.StatusOK)
+		}
+		return
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
 	res.WriteHeader(http.StatusAccepted)
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder(t *testing.T) {
+	errDB := errors.New("connection refused")
+	tests := []struct {
+		name        string
+		isNew       bool
+		anotherUser bool
+		checkErr    error
+		createErr   error
+		recheck     bool
+		expStatus   int
+		expCode     string
+	}{
+		{name: "accepted", isNew: true, checkErr: pgx.ErrNoRows, expStatus: http.StatusAccepted},
+		{name: "already uploaded", expStatus: http.StatusOK},
+		{name: "another user", anotherUser: true, expStatus: http.StatusConflict, expCode: problem.CodeOrderConflict},
+		{name: "check fails", anotherUser: true, checkErr: errDB, expStatus: http.StatusInternalServerError, expCode: problem.CodeInternal},
+		{name: "create fails", isNew: true, checkErr: pgx.ErrNoRows, createErr: errDB,
+			expStatus: http.StatusInternalServerError, expCode: problem.CodeInternal},
+		{name: "concurrent upload by another user", isNew: true, checkErr: pgx.ErrNoRows, createErr: storage.ErrOrderExists,
+			recheck: true, expStatus: http.StatusConflict, expCode: problem.CodeOrderConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			mock.EXPECT().CheckIfOrderExists(gomock.Any(), gomock.Any()).Return(test.isNew, test.anotherUser, test.checkErr)
+			if test.isNew {
+				mock.EXPECT().CreateNewOrder(gomock.Any(), gomock.Any()).Return(test.createErr)
+			}
+			if test.recheck {
+				mock.EXPECT().CheckIfOrderExists(gomock.Any(), gomock.Any()).Return(false, true, nil)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("12345678903"))
+			req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+			recorder := httptest.NewRecorder()
+			http.HandlerFunc(Order).ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expCode != "" {
+				var details problem.Details
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+				require.Equal(t, test.expCode, details.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+)
+
+const maxBatchOrders = 10000
+
+type BatchOrderResult struct {
+	OrderNumber string `json:"number"`
+	Result      string `json:"result"`
+}
+
+// OrderBatch загружает сразу несколько заказов. Номера передаются
+// JSON-массивом или по одному на строку
+func OrderBatch(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	numbers, err := parseBatchNumbers(req.Header.Get("Content-Type"), data)
+	if err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	if len(numbers) == 0 {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "batch contains no order numbers")
+		return
+	}
+	if len(numbers) > maxBatchOrders {
+		problem.Error(res, req, http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge,
+			"batch must contain at most "+strconv.Itoa(maxBatchOrders)+" order numbers")
+		return
+	}
+	results := make([]BatchOrderResult, len(numbers))
+	var orders []storage.OrderData
+	var positions []int
+	date := time.Now().Format(time.RFC3339)
+	for i, number := range numbers {
+		results[i].OrderNumber = number
+		orderNumber, err := utils.ParseOrderNumber(number)
+		if err != nil {
+			results[i].Result = storage.BatchInvalidFormat
+			continue
+		}
+		if !utils.IsOrderNumberValid(orderNumber) {
+			results[i].Result = storage.BatchInvalidLuhn
+			continue
+		}
+		orders = append(orders, storage.OrderData{OrderNumber: orderNumber, Date: date})
+		positions = append(positions, i)
+	}
+	accepted := false
+	if len(orders) > 0 {
+		stored, err := storage.PgxStorage.CreateOrdersBatch(storage.ST, ctx, orders)
+		if err != nil {
+			problem.Internal(res, req, err)
+			return
+		}
+		for i, result := range stored {
+			results[positions[i]].Result = result
+			accepted = accepted || result == storage.BatchAccepted
+		}
+	}
+	result, err := json.Marshal(results)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	if accepted {
+		res.WriteHeader(http.StatusAccepted)
+	} else {
+		res.WriteHeader(http.StatusOK)
+	}
+	res.Write(result)
+}
+
+// parseBatchNumbers разбирает тело запроса в список номеров заказов.
+// Для application/json ожидается массив строк или чисел,
+// иначе номера читаются построчно
+func parseBatchNumbers(contentType string, data []byte) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var numbers []string
+	if mediaType == "application/json" {
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var number string
+			if err := json.Unmarshal(item, &number); err != nil {
+				number = string(item)
+			}
+			numbers = append(numbers, strings.TrimSpace(number))
+		}
+		return numbers, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			numbers = append(numbers, line)
+		}
+	}
+	return numbers, scanner.Err()
+}
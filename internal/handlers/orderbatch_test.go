@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		stored      []string
+		expStatus   int
+		expResults  []string
+	}{
+		{
+			name:        "json array",
+			contentType: "application/json",
+			body:        `["12345678903", 79927398713, "12345678904", "abc"]`,
+			stored:      []string{storage.BatchAccepted, storage.BatchConflict},
+			expStatus:   http.StatusAccepted,
+			expResults:  []string{storage.BatchAccepted, storage.BatchConflict, storage.BatchInvalidLuhn, storage.BatchInvalidFormat},
+		},
+		{
+			name:        "newline delimited",
+			contentType: "text/plain",
+			body:        "12345678903\n\n79927398713\n9223372036854775808\n",
+			stored:      []string{storage.BatchDuplicateOwn, storage.BatchDuplicateOwn},
+			expStatus:   http.StatusOK,
+			expResults:  []string{storage.BatchDuplicateOwn, storage.BatchDuplicateOwn, storage.BatchInvalidFormat},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			mock.EXPECT().CreateOrdersBatch(gomock.Any(), gomock.Len(len(test.stored))).Times(1).Return(test.stored, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/batch", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+			recorder := httptest.NewRecorder()
+			http.HandlerFunc(OrderBatch).ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			var results []BatchOrderResult
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results))
+			require.Len(t, results, len(test.expResults))
+			for i, result := range results {
+				require.Equal(t, test.expResults[i], result.Result)
+			}
+		})
+	}
+}
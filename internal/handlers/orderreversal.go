@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/accrual"
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// RecheckWindow - сколько после начисления заказ сверяется с системой
+// расчета на случай возврата, 0 - сверка выключена
+var RecheckWindow time.Duration
+
+// accrualActor - автор отмен, найденных сверкой, в журнале аудита
+const accrualActor = "accrual"
+
+// ReverseAccrualRequest - причина отмены и сумма в баллах системы расчета.
+// Без суммы отменяется все оставшееся начисление
+type ReverseAccrualRequest struct {
+	Reason string  `json:"reason"`
+	Amount float64 `json:"sum"`
+}
+
+// ReverseAccrual отменяет начисление по заказу при возврате товара.
+// Доступно администраторам и партнерам
+func ReverseAccrual(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	orderNumber, ok := orderParam(res, req)
+	if !ok {
+		return
+	}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	var reverse ReverseAccrualRequest
+	if err := json.Unmarshal(data, &reverse); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	var fields []problem.FieldError
+	if strings.TrimSpace(reverse.Reason) == "" {
+		fields = append(fields, problem.FieldError{Field: "reason", Code: "required", Detail: "reversal reason is required"})
+	}
+	if reverse.Amount < 0 {
+		fields = append(fields, problem.FieldError{Field: "sum", Code: "negative", Detail: "sum must not be negative"})
+	}
+	if len(fields) > 0 {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(fields...))
+		return
+	}
+	reversal, err := storage.PgxStorage.ReverseAccrual(storage.ST, ctx, storage.AccrualReversal{
+		OrderNumber: orderNumber,
+		Amount:      int(math.Round(reverse.Amount * 100)),
+		Actor:       dataLogin,
+		Role:        roles.FromContext(ctx),
+		Reason:      reverse.Reason,
+	})
+	switch {
+	case errors.Is(err, storage.ErrOrderNotFound):
+		problem.Error(res, req, http.StatusNotFound, problem.CodeNotFound, "order not found")
+		return
+	case errors.Is(err, storage.ErrNothingToReverse):
+		problem.Error(res, req, http.StatusConflict, problem.CodeNothingToReverse, "the order has no accrual left to reverse")
+		return
+	case errors.Is(err, storage.ErrReversalTooLarge):
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "sum", Code: "exceeds_accrual", Detail: "sum exceeds the accrual left on the order"}))
+		return
+	case err != nil:
+		problem.Internal(res, req, err)
+		return
+	}
+	notifyReversal(ctx, reversal)
+	result, err := json.Marshal(reversal)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(result)
+}
+
+// RecheckOrders сверяет недавно начисленные заказы с системой расчета:
+// если заказ стал INVALID или начисление уменьшилось (возврат товара),
+// разница отменяется
+func RecheckOrders() {
+	if Accrual.Breaker().State() == accrual.StateOpen {
+		return
+	}
+	ctx := context.Background()
+	orders, err := storage.PgxStorage.GetRecentProcessedOrders(storage.ST, ctx, RecheckWindow)
+	if err != nil {
+		logger.Default().Errorw("failed to get processed orders", "error", err)
+		return
+	}
+	for _, order := range orders {
+		actual, err := Accrual.GetOrder(ctx, order.OrderNumber)
+		if err != nil {
+			continue
+		}
+		var amount int
+		switch actual.Status {
+		case accrual.StatusInvalid:
+			// 0 - отменить все оставшееся начисление
+		case accrual.StatusProcessed:
+			amount = order.Accrual - int(math.Round(actual.Accrual*100))
+			if amount <= 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		reversal, err := storage.PgxStorage.ReverseAccrual(storage.ST, ctx, storage.AccrualReversal{
+			OrderNumber: order.OrderNumber,
+			Amount:      amount,
+			Actor:       accrualActor,
+			Role:        roles.System,
+			Reason:      "accrual system reported " + actual.Status,
+		})
+		if err != nil {
+			logger.Default().Errorw("failed to reverse accrual", "order", order.OrderNumber, "error", err)
+			continue
+		}
+		notifyReversal(ctx, reversal)
+	}
+}
+
+// notifyReversal сообщает пользователю о новом состоянии заказа и балансе
+func notifyReversal(ctx context.Context, reversal storage.AccrualReversalResponse) {
+	notify.Default.Publish(reversal.Login, notify.OrderReversed, reversal)
+	notify.PublishBalance(ctx, reversal.Login)
+}
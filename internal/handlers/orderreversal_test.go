@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseAccrual(t *testing.T) {
+	reversed := storage.AccrualReversalResponse{Login: "customer", OrderNumber: "2377225624", Amount: 100, Debited: 40, Debt: 85, Status: storage.OrderReversed}
+	tests := []struct {
+		name      string
+		body      string
+		expStore  *storage.AccrualReversal
+		storeErr  error
+		expStatus int
+		expCode   string
+	}{
+		{"full reversal", `{"reason":"goods returned"}`,
+			&storage.AccrualReversal{OrderNumber: 2377225624, Actor: "partner", Role: roles.Partner, Reason: "goods returned"},
+			nil, http.StatusOK, ""},
+		{"partial reversal", `{"reason":"one item returned","sum":12.5}`,
+			&storage.AccrualReversal{OrderNumber: 2377225624, Amount: 1250, Actor: "partner", Role: roles.Partner, Reason: "one item returned"},
+			nil, http.StatusOK, ""},
+		{"no reason", `{"sum":10}`, nil, nil, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"negative sum", `{"reason":"returned","sum":-1}`, nil, nil, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"too large", `{"reason":"returned","sum":1000}`, nil,
+			storage.ErrReversalTooLarge, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"nothing left", `{"reason":"returned"}`, nil,
+			storage.ErrNothingToReverse, http.StatusConflict, problem.CodeNothingToReverse},
+		{"not found", `{"reason":"returned"}`, nil,
+			storage.ErrOrderNotFound, http.StatusNotFound, problem.CodeNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			switch {
+			case test.expStore != nil:
+				mock.EXPECT().ReverseAccrual(gomock.Any(), *test.expStore).Return(reversed, nil)
+			case test.storeErr != nil:
+				mock.EXPECT().ReverseAccrual(gomock.Any(), gomock.Any()).Return(storage.AccrualReversalResponse{}, test.storeErr)
+			}
+			r := chi.NewRouter()
+			r.Post("/admin/orders/{order}/reverse", ReverseAccrual)
+			req := httptest.NewRequest(http.MethodPost, "/admin/orders/2377225624/reverse", strings.NewReader(test.body))
+			ctx := context.WithValue(req.Context(), storage.UserLoginCtxKey, "partner")
+			req = req.WithContext(roles.WithRole(ctx, roles.Partner))
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expStatus == http.StatusOK {
+				var result storage.AccrualReversalResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+				require.Equal(t, reversed.Debt, result.Debt)
+				require.Equal(t, storage.OrderReversed, result.Status)
+				return
+			}
+			var details problem.Details
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			require.Equal(t, test.expCode, details.Code)
+		})
+	}
+}
@@ -2,32 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
-	"io"
 	"net/http"
 	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
-	"github.com/golang-jwt/jwt"
 )
 
-type Payload struct {
-	Login string
-	Exp   int64
-}
-
 func Registration(res http.ResponseWriter, req *http.Request) {
 
 	regData := storage.RegisterRequest{}
 
-	data, err := io.ReadAll(req.Body)
-
-	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+	data, ok := readBody(res, req)
+	if !ok {
 		return
 	}
 
-	if err = json.Unmarshal(data, &regData); err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+	if err := json.Unmarshal(data, &regData); err != nil {
+		problem.InvalidJSON(res, req, err)
 		return
 	}
 	userData := storage.UserData{}
@@ -36,32 +28,22 @@ func Registration(res http.ResponseWriter, req *http.Request) {
 	userData.Date = time.Now().Format(time.RFC3339)
 	result, err := storage.PgxStorage.CheckUserExists(storage.ST, userData)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
 	if result {
-		res.WriteHeader(http.StatusConflict)
+		problem.Write(res, req, problem.New(http.StatusConflict, problem.CodeLoginTaken, "login is already taken").
+			WithErrors(problem.FieldError{Field: "login", Code: "taken"}))
 		return
 	}
 	err = storage.PgxStorage.CreateNewUser(storage.ST, req.Context(), userData)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
-	payloadData := Payload{}
-	payloadData.Login = userData.Login
-	payloadData.Exp = time.Now().Add(time.Hour * 72).Unix()
-	payload := jwt.MapClaims{
-		"sub": payloadData.Login,
-		"exp": payloadData.Exp,
-	}
-
-	// Создаем новый JWT-токен и подписываем его по алгоритму HS256
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-
-	authToken, err := token.SignedString(jwtSecretKey)
+	authToken, err := storage.NewToken(userData.Login)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
 	res.Header().Add("Authorization", authToken)
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// CancelWindow - сколько после списания пользователь может его отменить
+var CancelWindow = 24 * time.Hour
+
+// Размер страницы журнала аудита
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// RefundRequest - причина возврата, обязательна для аудита
+type RefundRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelWithdrawal отменяет собственное списание пользователя в пределах CancelWindow
+func CancelWithdrawal(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	orderNumber, ok := orderParam(res, req)
+	if !ok {
+		return
+	}
+	reverseWithdrawal(res, req, storage.WithdrawalReversal{
+		OrderNumber: orderNumber,
+		Customer:    dataLogin,
+		Actor:       dataLogin,
+		Role:        roles.User,
+		Reason:      "cancelled by user",
+		Window:      CancelWindow,
+	})
+}
+
+// RefundWithdrawal возвращает баллы по списанию любого пользователя без
+// ограничения по времени. Доступно администраторам и партнерам
+func RefundWithdrawal(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	orderNumber, ok := orderParam(res, req)
+	if !ok {
+		return
+	}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	var refund RefundRequest
+	if err := json.Unmarshal(data, &refund); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	if strings.TrimSpace(refund.Reason) == "" {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "reason", Code: "required", Detail: "refund reason is required"}))
+		return
+	}
+	reverseWithdrawal(res, req, storage.WithdrawalReversal{
+		OrderNumber: orderNumber,
+		Actor:       dataLogin,
+		Role:        roles.FromContext(ctx),
+		Reason:      refund.Reason,
+	})
+}
+
+// GetAuditLog возвращает последние записи журнала аудита (?limit=N)
+func GetAuditLog(res http.ResponseWriter, req *http.Request) {
+	limit, ok := queryInt(res, req, "limit", defaultAuditLimit, 1, maxAuditLimit)
+	if !ok {
+		return
+	}
+	entries, err := storage.PgxStorage.GetAuditLog(storage.ST, req.Context(), int(limit))
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(entries) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(entries)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	writeJSONWithETag(res, req, result)
+}
+
+func orderParam(res http.ResponseWriter, req *http.Request) (uint64, bool) {
+	orderNumber, err := utils.ParseOrderNumber(chi.URLParam(req, "order"))
+	if err != nil {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "order number must consist of digits only")
+		return 0, false
+	}
+	return orderNumber, true
+}
+
+func reverseWithdrawal(res http.ResponseWriter, req *http.Request, reversal storage.WithdrawalReversal) {
+	ctx := req.Context()
+	withdrawal, err := storage.PgxStorage.ReverseWithdrawal(storage.ST, ctx, reversal)
+	switch {
+	case errors.Is(err, storage.ErrWithdrawalNotFound):
+		problem.Error(res, req, http.StatusNotFound, problem.CodeNotFound, "withdrawal not found")
+		return
+	case errors.Is(err, storage.ErrAlreadyReversed):
+		problem.Error(res, req, http.StatusConflict, problem.CodeAlreadyReversed, "the withdrawal is already reversed")
+		return
+	case errors.Is(err, storage.ErrCancelWindowClosed):
+		problem.Error(res, req, http.StatusConflict, problem.CodeCancelWindowClosed, "the withdrawal can no longer be cancelled")
+		return
+	case err != nil:
+		problem.Internal(res, req, err)
+		return
+	}
+	notify.Default.Publish(withdrawal.Login, notify.WithdrawalReversed, withdrawal)
+	notify.PublishBalance(ctx, withdrawal.Login)
+	result, err := json.Marshal(withdrawal)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(result)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseWithdrawal(t *testing.T) {
+	reversed := storage.WithdrawResponse{Login: "user", OrderNumber: "2377225624", Amount: 751, Status: storage.WithdrawalReversed}
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		role       string
+		expStore   *storage.WithdrawalReversal
+		storeErr   error
+		expStatus  int
+		expCode    string
+		expReverse bool
+	}{
+		{"user cancels", "/withdrawals/2377225624/cancel", "", roles.User,
+			&storage.WithdrawalReversal{OrderNumber: 2377225624, Customer: "user", Actor: "user", Role: roles.User, Reason: "cancelled by user", Window: CancelWindow},
+			nil, http.StatusOK, "", true},
+		{"window closed", "/withdrawals/2377225624/cancel", "", roles.User, nil,
+			storage.ErrCancelWindowClosed, http.StatusConflict, problem.CodeCancelWindowClosed, false},
+		{"already reversed", "/withdrawals/2377225624/cancel", "", roles.User, nil,
+			storage.ErrAlreadyReversed, http.StatusConflict, problem.CodeAlreadyReversed, false},
+		{"not found", "/withdrawals/2377225624/cancel", "", roles.User, nil,
+			storage.ErrWithdrawalNotFound, http.StatusNotFound, problem.CodeNotFound, false},
+		{"partner refunds", "/admin/withdrawals/2377225624/refund", `{"reason":"order cancelled by shop"}`, roles.Partner,
+			&storage.WithdrawalReversal{OrderNumber: 2377225624, Actor: "user", Role: roles.Partner, Reason: "order cancelled by shop"},
+			nil, http.StatusOK, "", true},
+		{"refund without reason", "/admin/withdrawals/2377225624/refund", `{"reason":" "}`, roles.Admin, nil,
+			nil, http.StatusUnprocessableEntity, problem.CodeValidationFailed, false},
+		{"bad order", "/withdrawals/abc/cancel", "", roles.User, nil,
+			nil, http.StatusBadRequest, problem.CodeInvalidRequest, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			switch {
+			case test.expStore != nil:
+				mock.EXPECT().ReverseWithdrawal(gomock.Any(), *test.expStore).Return(reversed, nil)
+			case test.storeErr != nil:
+				mock.EXPECT().ReverseWithdrawal(gomock.Any(), gomock.Any()).Return(storage.WithdrawResponse{}, test.storeErr)
+			}
+			r := chi.NewRouter()
+			r.Post("/withdrawals/{order}/cancel", CancelWithdrawal)
+			r.Post("/admin/withdrawals/{order}/refund", RefundWithdrawal)
+			req := httptest.NewRequest(http.MethodPost, test.url, strings.NewReader(test.body))
+			ctx := context.WithValue(req.Context(), storage.UserLoginCtxKey, "user")
+			req = req.WithContext(roles.WithRole(ctx, test.role))
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expReverse {
+				var withdrawal storage.WithdrawResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &withdrawal))
+				require.Equal(t, storage.WithdrawalReversed, withdrawal.Status)
+				return
+			}
+			var details problem.Details
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			require.Equal(t, test.expCode, details.Code)
+		})
+	}
+}
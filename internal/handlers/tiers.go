@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// RecalculateTiers - ночной пересчет уровней программы лояльности
+func RecalculateTiers() {
+	ctx := context.Background()
+	changes, err := storage.PgxStorage.RecalculateTiers(storage.ST, ctx)
+	if err != nil {
+		logger.Default().Errorw("failed to recalculate loyalty tiers", "error", err)
+		return
+	}
+	for _, change := range changes {
+		metrics.TierChanges.WithLabelValues(change.Direction).Inc()
+		logger.Default().Infow("loyalty tier changed",
+			"login", change.Login,
+			"from", change.From,
+			"to", change.To,
+		)
+		notify.PublishBalance(ctx, change.Login)
+	}
+}
+
+// GetTierHistory возвращает историю смены уровня пользователя
+func GetTierHistory(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	history, err := storage.PgxStorage.GetTierHistory(storage.ST, ctx)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(history) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(history)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	writeJSONWithETag(res, req, result)
+}
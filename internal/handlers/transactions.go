@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// Размер страницы ленты операций
+const (
+	defaultTransactionsLimit = 100
+	maxTransactionsLimit     = 1000
+)
+
+// GetTransactions возвращает ленту движений баллов пользователя от старых
+// к новым с балансом после каждой операции. Следующая страница
+// запрашивается с ?after=<cursor последней полученной операции>
+func GetTransactions(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	limit, ok := queryInt(res, req, "limit", defaultTransactionsLimit, 1, maxTransactionsLimit)
+	if !ok {
+		return
+	}
+	var after storage.TxCursor
+	if value := req.URL.Query().Get("after"); value != "" {
+		var err error
+		if after, err = storage.ParseTxCursor(value); err != nil {
+			problem.Write(res, req, problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "request has invalid fields").
+				WithErrors(problem.FieldError{Field: "after", Code: "invalid_cursor", Detail: "after must be a cursor from a previous page"}))
+			return
+		}
+	}
+	transactions, err := storage.PgxStorage.GetTransactions(storage.ST, ctx, after, int(limit))
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(transactions) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(transactions)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	writeJSONWithETag(res, req, result)
+}
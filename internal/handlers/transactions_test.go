@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTransactions(t *testing.T) {
+	accrued := storage.TxCursor{At: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), Kind: storage.TxAccrual, ID: 11}
+	withdrawn := storage.TxCursor{At: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), Kind: storage.TxWithdrawal, ID: 12}
+	feed := []storage.Transaction{
+		{Cursor: accrued.String(), Type: storage.TxAccrual, OrderNumber: "2377225624", Amount: 500, Balance: 500},
+		{Cursor: withdrawn.String(), Type: storage.TxWithdrawal, OrderNumber: "12345678903", Amount: -120, Balance: 380},
+	}
+	tests := []struct {
+		name      string
+		query     string
+		expAfter  storage.TxCursor
+		expLimit  int
+		result    []storage.Transaction
+		expStatus int
+		expCode   string
+	}{
+		{"first page", "", storage.TxCursor{}, defaultTransactionsLimit, feed, http.StatusOK, ""},
+		{"next page", "?after=" + accrued.String() + "&limit=2", accrued, 2, feed, http.StatusOK, ""},
+		{"end of feed", "?after=" + withdrawn.String(), withdrawn, defaultTransactionsLimit, nil, http.StatusNoContent, ""},
+		{"limit too large", "?limit=5000", storage.TxCursor{}, 0, nil, http.StatusBadRequest, problem.CodeValidationFailed},
+		{"bad cursor", "?after=12", storage.TxCursor{}, 0, nil, http.StatusBadRequest, problem.CodeValidationFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			if test.expCode == "" {
+				mock.EXPECT().GetTransactions(gomock.Any(), test.expAfter, test.expLimit).Return(test.result, nil)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/user/transactions"+test.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+			recorder := httptest.NewRecorder()
+			GetTransactions(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			switch {
+			case test.expStatus == http.StatusOK:
+				var result []storage.Transaction
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+				require.Equal(t, feed, result)
+			case test.expCode != "":
+				var details problem.Details
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+				require.Equal(t, test.expCode, details.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// TransferConfirmRequest - подтверждение крупного перевода паролем
+type TransferConfirmRequest struct {
+	Password string `json:"password"`
+}
+
+// Transfer переводит баллы другому пользователю. Крупный перевод
+// возвращается со статусом 202 и ждет подтверждения
+func Transfer(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	var transfer storage.TransferRequest
+	if err := json.Unmarshal(data, &transfer); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	var fieldErrors []problem.FieldError
+	if transfer.To == "" {
+		fieldErrors = append(fieldErrors, problem.FieldError{Field: "to", Code: "required", Detail: "recipient login is required"})
+	}
+	if transfer.To == dataLogin {
+		fieldErrors = append(fieldErrors, problem.FieldError{Field: "to", Code: "self_transfer", Detail: "points cannot be transferred to yourself"})
+	}
+	// сумма проверяется в копейках: 0.004 округляется до нуля
+	if storage.Cents(transfer.Amount) <= 0 {
+		fieldErrors = append(fieldErrors, problem.FieldError{Field: "sum", Code: "not_positive", Detail: "sum must be at least 0.01"})
+	}
+	if len(fieldErrors) > 0 {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(fieldErrors...))
+		return
+	}
+	result, err := storage.PgxStorage.CreateTransfer(storage.ST, ctx, transfer)
+	if err != nil {
+		transferError(res, req, err)
+		return
+	}
+	status := http.StatusOK
+	if result.State == storage.TransferPending {
+		status = http.StatusAccepted
+	} else {
+		notify.PublishBalance(ctx, result.From)
+		notify.PublishBalance(ctx, result.To)
+	}
+	writeTransfer(res, req, status, result)
+}
+
+// ConfirmTransfer подтверждает крупный перевод повторным вводом пароля
+func ConfirmTransfer(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "transfer id must be a number")
+		return
+	}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	var confirm TransferConfirmRequest
+	if err := json.Unmarshal(data, &confirm); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	valid, err := storage.PgxStorage.CheckUserPassword(storage.ST, ctx, storage.UserData{Login: dataLogin, Password: confirm.Password})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		problem.Internal(res, req, err)
+		return
+	}
+	if !valid {
+		problem.Error(res, req, http.StatusForbidden, problem.CodeInvalidCredentials, "password does not match")
+		return
+	}
+	result, err := storage.PgxStorage.ConfirmTransfer(storage.ST, ctx, id)
+	if err != nil {
+		transferError(res, req, err)
+		return
+	}
+	notify.PublishBalance(ctx, result.From)
+	notify.PublishBalance(ctx, result.To)
+	writeTransfer(res, req, http.StatusOK, result)
+}
+
+// GetTransfers возвращает входящие и исходящие переводы пользователя
+func GetTransfers(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ok := ctx.Value(storage.UserLoginCtxKey).(string)
+	if !ok {
+		problem.Internal(res, req, storage.ErrNoLogin)
+		return
+	}
+	transfers, err := storage.PgxStorage.GetTransfers(storage.ST, ctx)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(transfers) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(transfers)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	writeJSONWithETag(res, req, result)
+}
+
+func writeTransfer(res http.ResponseWriter, req *http.Request, status int, transfer storage.TransferResponse) {
+	result, err := json.Marshal(transfer)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(result)
+}
+
+// transferError отвечает на ошибки перевода
+func transferError(res http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrRecipientNotFound):
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeRecipientNotFound, "recipient does not exist").
+			WithErrors(problem.FieldError{Field: "to", Code: "unknown_login"}))
+	case errors.Is(err, storage.ErrTransferLimit):
+		problem.Error(res, req, http.StatusUnprocessableEntity, problem.CodeTransferLimit, "the transfer exceeds the daily limit")
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		problem.Error(res, req, http.StatusPaymentRequired, problem.CodeInsufficientFunds, "not enough points on the balance")
+	case errors.Is(err, storage.ErrPointsOnHold):
+		problem.Error(res, req, http.StatusPaymentRequired, problem.CodePointsOnHold, "points received by transfer are on hold and cannot be transferred yet")
+	case errors.Is(err, storage.ErrTransferNotFound):
+		problem.Error(res, req, http.StatusNotFound, problem.CodeNotFound, "transfer not found")
+	case errors.Is(err, storage.ErrTransferExpired):
+		problem.Error(res, req, http.StatusGone, problem.CodeTransferExpired, "the transfer was not confirmed in time")
+	case errors.Is(err, storage.ErrTransferNotPending):
+		problem.Error(res, req, http.StatusConflict, problem.CodeTransferNotPending, "the transfer is not waiting for confirmation")
+	default:
+		problem.Internal(res, req, err)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		result    storage.TransferResponse
+		storeErr  error
+		expStatus int
+		expCode   string
+	}{
+		{"completed", `{"to":"mom","sum":100}`, storage.TransferResponse{From: "user", To: "mom", State: storage.TransferCompleted}, nil,
+			http.StatusOK, ""},
+		{"needs confirmation", `{"to":"mom","sum":600}`, storage.TransferResponse{From: "user", To: "mom", State: storage.TransferPending}, nil,
+			http.StatusAccepted, ""},
+		{"rounds to zero", `{"to":"mom","sum":0.004}`, storage.TransferResponse{}, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"to self", `{"to":"user","sum":100}`, storage.TransferResponse{}, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{"unknown recipient", `{"to":"ghost","sum":100}`, storage.TransferResponse{}, storage.ErrRecipientNotFound,
+			http.StatusUnprocessableEntity, problem.CodeRecipientNotFound},
+		{"daily limit", `{"to":"mom","sum":100}`, storage.TransferResponse{}, storage.ErrTransferLimit,
+			http.StatusUnprocessableEntity, problem.CodeTransferLimit},
+		{"points on hold", `{"to":"mom","sum":100}`, storage.TransferResponse{}, storage.ErrPointsOnHold,
+			http.StatusPaymentRequired, problem.CodePointsOnHold},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			if test.expCode != problem.CodeValidationFailed {
+				mock.EXPECT().CreateTransfer(gomock.Any(), gomock.Any()).Return(test.result, test.storeErr)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/balance/transfer", strings.NewReader(test.body))
+			req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+			recorder := httptest.NewRecorder()
+			http.HandlerFunc(Transfer).ServeHTTP(recorder, req)
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expCode == "" {
+				var transfer storage.TransferResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &transfer))
+				require.Equal(t, test.result.State, transfer.State)
+				return
+			}
+			var details problem.Details
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			require.Equal(t, test.expCode, details.Code)
+		})
+	}
+}
+
+func TestConfirmTransfer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+
+	serve := func(password string) *httptest.ResponseRecorder {
+		r := chi.NewRouter()
+		r.Post("/balance/transfer/{id}/confirm", ConfirmTransfer)
+		req := httptest.NewRequest(http.MethodPost, "/balance/transfer/7/confirm", strings.NewReader(`{"password":"`+password+`"}`))
+		req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, "user"))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	mock.EXPECT().CheckUserPassword(gomock.Any(), storage.UserData{Login: "user", Password: "wrong"}).Return(false, nil)
+	require.Equal(t, http.StatusForbidden, serve("wrong").Code)
+
+	mock.EXPECT().CheckUserPassword(gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+	mock.EXPECT().ConfirmTransfer(gomock.Any(), int64(7)).Return(storage.TransferResponse{}, storage.ErrTransferExpired)
+	require.Equal(t, http.StatusGone, serve("secret").Code)
+
+	mock.EXPECT().ConfirmTransfer(gomock.Any(), int64(7)).
+		Return(storage.TransferResponse{ID: 7, From: "user", To: "mom", State: storage.TransferCompleted}, nil)
+	require.Equal(t, http.StatusOK, serve("secret").Code)
+}
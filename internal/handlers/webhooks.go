@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+}
+
+func CreateWebhook(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	webhookReq := WebhookRequest{}
+	data, ok := readBody(res, req)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(data, &webhookReq); err != nil {
+		problem.InvalidJSON(res, req, err)
+		return
+	}
+	endpoint, err := url.ParseRequestURI(webhookReq.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "url", Code: "invalid_url", Detail: "url must be an absolute http or https URL"}))
+		return
+	}
+	// вебхуки доставляются только на публичные адреса
+	if err = webhook.CheckURL(ctx, endpoint); err != nil {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "url", Code: "forbidden_address", Detail: "url must resolve to public addresses only"}))
+		return
+	}
+	var webhookData storage.WebhookData
+	webhookData.URL = endpoint.String()
+	webhookData.Date = time.Now().Format(time.RFC3339)
+	webhookData.Secret, err = webhook.NewSecret()
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	webhookData, err = storage.PgxStorage.CreateWebhook(storage.ST, ctx, webhookData)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	// Секрет показывается только при регистрации
+	result, err := json.Marshal(webhookData)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(http.StatusCreated)
+	res.Write(result)
+}
+
+func GetWebhooks(res http.ResponseWriter, req *http.Request) {
+	webhooks, err := storage.PgxStorage.GetWebhooks(storage.ST, req.Context())
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result, err := json.Marshal(webhooks)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(result)
+}
+
+func DeleteWebhook(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "webhook id must be a number")
+		return
+	}
+	ok, err := storage.PgxStorage.DeleteWebhook(storage.ST, req.Context(), id)
+	if err != nil {
+		problem.Internal(res, req, err)
+		return
+	}
+	if !ok {
+		problem.Error(res, req, http.StatusNotFound, problem.CodeNotFound, "webhook not found")
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -4,48 +4,53 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"strconv"
 	"sync"
-	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
 )
 
 func Withdraw(res http.ResponseWriter, req *http.Request) {
 	var userData storage.UserData
-	var orderData storage.OrderData
 	var ctxOrderKey, ctxUserKey storage.CtxKey
 	ctx := req.Context()
 	dataLogin, ok := ctx.Value(storage.UserLoginCtxKey).(string)
 	if !ok {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, storage.ErrNoLogin)
 		return
 	}
 	userData.Login = dataLogin
 
 	withdrawalData := storage.WithdrawRequest{}
-	data, err := io.ReadAll(req.Body)
-	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+	data, ok := readBody(res, req)
+	if !ok {
 		return
 	}
 
-	if err = json.Unmarshal(data, &withdrawalData); err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+	if err := json.Unmarshal(data, &withdrawalData); err != nil {
+		problem.InvalidJSON(res, req, err)
 		return
 	}
-	orderNumber, err := strconv.ParseUint(withdrawalData.OrderNumber, 10, 64)
+	orderNumber, err := utils.ParseOrderNumber(withdrawalData.OrderNumber)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+		problem.Write(res, req, problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "order", Code: "not_a_number", Detail: "order number must consist of digits only"}))
 		return
 	}
 	ok = utils.IsOrderNumberValid(orderNumber)
 	if !ok {
-		res.WriteHeader(http.StatusUnprocessableEntity)
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "order number fails the Luhn check").
+			WithErrors(problem.FieldError{Field: "order", Code: "invalid_luhn"}))
+		return
+	}
+	// сумма проверяется в копейках: нулевое списание записалось бы
+	// в заказы как начисление
+	if storage.Cents(withdrawalData.Amount) <= 0 {
+		problem.Write(res, req, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "request has invalid fields").
+			WithErrors(problem.FieldError{Field: "sum", Code: "not_positive", Detail: "sum must be at least 0.01"}))
 		return
 	}
 	ctxOrderKey = storage.OrderNumberCtxKey
@@ -55,24 +60,15 @@ func Withdraw(res http.ResponseWriter, req *http.Request) {
 	mut := sync.Mutex{}
 	mut.Lock()
 	defer mut.Unlock()
-	err = storage.PgxStorage.WithdrawFromUser(storage.ST, ctx, withdrawalData)
-	if errors.Is(err, fmt.Errorf("payment required")) {
-		res.WriteHeader(http.StatusPaymentRequired)
-		return
-	}
-	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+	withdrawal, err := storage.PgxStorage.WithdrawFromUser(storage.ST, ctx, withdrawalData)
+	if errors.Is(err, storage.ErrInsufficientFunds) {
+		problem.Error(res, req, http.StatusPaymentRequired, problem.CodeInsufficientFunds, "not enough points on the balance")
 		return
 	}
-	orderData.Accrual = 0
-	orderData.OrderNumber, _ = strconv.ParseUint(withdrawalData.OrderNumber, 10, 64)
-	orderData.Withdrawal = int(withdrawalData.Amount * 100)
-	orderData.Date = time.Now().Format(time.RFC3339)
-	orderData.User = userData.Login
-	err = storage.PgxStorage.CreateNewOrder(storage.ST, ctx, orderData)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+		problem.Internal(res, req, err)
 		return
 	}
+	notify.PublishWithdrawal(ctx, userData.Login, withdrawal)
 	res.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithdrawProblems(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		storeErr  error
+		expStatus int
+		expCode   string
+		expField  string
+	}{
+		{"insufficient funds", `{"order":"2377225624","sum":751}`, storage.ErrInsufficientFunds,
+			http.StatusPaymentRequired, problem.CodeInsufficientFunds, ""},
+		{"invalid luhn", `{"order":"2377225625","sum":751}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "order"},
+		{"negative sum", `{"order":"2377225624","sum":-5}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed, "sum"},
+		{"sum rounding to zero", `{"order":"2377225624","sum":0.004}`, nil,
+			http.StatusUnprocessableEntity, problem.CodeValidationFailed, "sum"},
+		{"wrong type", `{"order":"2377225624","sum":"751"}`, nil,
+			http.StatusBadRequest, problem.CodeInvalidJSON, "sum"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			if test.storeErr != nil {
+				mock.EXPECT().WithdrawFromUser(gomock.Any(), gomock.Any()).Times(1).Return(storage.WithdrawResponse{}, test.storeErr)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/balance/withdraw", strings.NewReader(test.body))
+			ctx := context.WithValue(req.Context(), storage.UserLoginCtxKey, "user")
+			ctx = context.WithValue(ctx, storage.RequestIDCtxKey, "req-1")
+			recorder := httptest.NewRecorder()
+			http.HandlerFunc(Withdraw).ServeHTTP(recorder, req.WithContext(ctx))
+
+			require.Equal(t, test.expStatus, recorder.Code)
+			require.Equal(t, problem.ContentType, recorder.Header().Get("Content-Type"))
+			var details problem.Details
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			require.Equal(t, test.expCode, details.Code)
+			require.Equal(t, "req-1", details.RequestID)
+			if test.expField != "" {
+				require.Len(t, details.Errors, 1)
+				require.Equal(t, test.expField, details.Errors[0].Field)
+			}
+		})
+	}
+}
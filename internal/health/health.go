@@ -0,0 +1,126 @@
+// Package health отдает состояние сервиса для проб живости и готовности
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Статусы проверок
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckTimeout ограничивает время одной проверки готовности
+const CheckTimeout = 2 * time.Second
+
+// Check проверяет одну зависимость сервиса, nil означает готовность
+type Check func(ctx context.Context) error
+
+// CheckResult - результат проверки одной зависимости
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report - тело ответа /readyz
+type Report struct {
+	Status       string                 `json:"status"`
+	ShuttingDown bool                   `json:"shutting_down,omitempty"`
+	Checks       map[string]CheckResult `json:"checks"`
+}
+
+var (
+	mu           sync.RWMutex
+	checks       = map[string]Check{}
+	shuttingDown atomic.Bool
+)
+
+// Register добавляет проверку готовности. Повторная регистрация
+// с тем же именем заменяет проверку
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// SetShuttingDown переводит готовность в отказ на время
+// корректной остановки сервера
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Ready выполняет все проверки параллельно
+func Ready(ctx context.Context) Report {
+	mu.RLock()
+	registered := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		registered[name] = check
+	}
+	mu.RUnlock()
+
+	report := Report{
+		Status:       StatusOK,
+		ShuttingDown: shuttingDown.Load(),
+		Checks:       make(map[string]CheckResult, len(registered)),
+	}
+	if report.ShuttingDown {
+		report.Status = StatusFail
+	}
+	var (
+		wg       sync.WaitGroup
+		resultMu sync.Mutex
+	)
+	for name, check := range registered {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			result := CheckResult{Status: StatusOK}
+			if err := check(checkCtx); err != nil {
+				result = CheckResult{Status: StatusFail, Error: err.Error()}
+			}
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// Liveness отвечает 200, пока процесс способен обслуживать запросы
+func Liveness(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// Readiness отвечает 200, если все зависимости доступны, иначе 503
+func Readiness(res http.ResponseWriter, req *http.Request) {
+	report := Ready(req.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(res, status, report)
+}
+
+func writeJSON(res http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	res.Write(data)
+}
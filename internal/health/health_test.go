@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	dbErr := error(nil)
+	Register("database", func(ctx context.Context) error { return dbErr })
+	Register("migrations", func(ctx context.Context) error { return nil })
+	defer shuttingDown.Store(false)
+
+	tests := []struct {
+		name      string
+		dbErr     error
+		shutdown  bool
+		expStatus int
+		expDB     string
+	}{
+		{"ready", nil, false, http.StatusOK, StatusOK},
+		{"database down", errors.New("connection refused"), false, http.StatusServiceUnavailable, StatusFail},
+		{"shutting down", nil, true, http.StatusServiceUnavailable, StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dbErr = test.dbErr
+			shuttingDown.Store(test.shutdown)
+			res := httptest.NewRecorder()
+			Readiness(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, test.expStatus, res.Code)
+			var report Report
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+			assert.Equal(t, test.expDB, report.Checks["database"].Status)
+			assert.Equal(t, StatusOK, report.Checks["migrations"].Status)
+			assert.Equal(t, test.shutdown, report.ShuttingDown)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package logger хранит структурированный логгер в контексте запроса,
+// чтобы обработчики и хранилище писали записи с request_id и логином
+package logger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Форматы вывода
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Redacted подставляется вместо значений секретных полей
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders никогда не попадают в лог в открытом виде
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+type ctxKey struct{}
+
+var base atomic.Pointer[zap.SugaredLogger]
+
+func init() {
+	base.Store(zap.NewNop().Sugar())
+}
+
+// New создает логгер с уровнем level (debug, info, warn, error)
+// и форматом json или console
+func New(level, format string) (*zap.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	var cfg zap.Config
+	switch format {
+	case FormatJSON:
+		cfg = zap.NewProductionConfig()
+	case FormatConsole:
+		cfg = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	return cfg.Build()
+}
+
+// SetDefault задает логгер, от которого наследуются логгеры запросов
+func SetDefault(l *zap.Logger) {
+	base.Store(l.Sugar())
+}
+
+// Default возвращает логгер для фоновых задач вне запроса
+func Default() *zap.SugaredLogger {
+	return base.Load()
+}
+
+// WithContext кладет логгер в контекст
+func WithContext(ctx context.Context, l *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext возвращает логгер запроса или логгер по умолчанию
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return Default()
+}
+
+// With добавляет поля к логгеру из контекста
+func With(ctx context.Context, args ...interface{}) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(args...))
+}
+
+// Headers возвращает заголовки для записи в лог, скрывая секретные
+func Headers(h http.Header) map[string]string {
+	result := make(map[string]string, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			result[name] = Redacted
+			continue
+		}
+		if len(values) > 0 {
+			result[name] = values[0]
+		}
+	}
+	return result
+}
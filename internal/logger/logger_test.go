@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHeadersRedactsSecrets(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=secret")
+	h.Set("Content-Type", "application/json")
+
+	logged := Headers(h)
+	assert.Equal(t, Redacted, logged["Authorization"])
+	assert.Equal(t, Redacted, logged["Cookie"])
+	assert.Equal(t, "application/json", logged["Content-Type"])
+}
+
+func TestFromContextKeepsFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	SetDefault(zap.New(core))
+	defer SetDefault(zap.NewNop())
+
+	ctx := With(context.Background(), "request_id", "abc")
+	FromContext(ctx).Infow("request")
+	FromContext(context.Background()).Infow("background")
+
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, "abc", logs.All()[0].ContextMap()["request_id"])
+	assert.NotContains(t, logs.All()[1].ContextMap(), "request_id")
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	_, err := New("loud", FormatJSON)
+	assert.Error(t, err)
+	_, err = New("info", "xml")
+	assert.Error(t, err)
+	_, err = New("debug", FormatJSON)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,95 @@
+// Package loyalty - уровни программы лояльности. Уровень определяется
+// суммой начислений за последние 12 месяцев и задает множитель,
+// с которым зачисляются баллы системы расчета
+package loyalty
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Window - за сколько месяцев учитываются начисления
+const Window = 12
+
+// Tier - уровень, доступный с MinAccrual баллов за Window месяцев
+type Tier struct {
+	Name       string
+	MinAccrual float64
+	Multiplier float64
+}
+
+// Table - уровни в порядке возрастания порога, первый доступен всем
+type Table []Tier
+
+// Default - уровни по умолчанию
+var Default = Table{
+	{Name: "BRONZE", MinAccrual: 0, Multiplier: 1},
+	{Name: "SILVER", MinAccrual: 1000, Multiplier: 1.25},
+	{Name: "GOLD", MinAccrual: 5000, Multiplier: 1.5},
+}
+
+// Validate проверяет, что таблица непуста, первый уровень не требует
+// начислений, пороги возрастают, а множители положительны
+func (t Table) Validate() error {
+	if len(t) == 0 {
+		return errors.New("at least one tier is required")
+	}
+	if t[0].MinAccrual != 0 {
+		return fmt.Errorf("first tier %q must start at 0", t[0].Name)
+	}
+	names := make(map[string]bool, len(t))
+	for i, tier := range t {
+		if tier.Name == "" {
+			return fmt.Errorf("tier %d has no name", i+1)
+		}
+		if names[tier.Name] {
+			return fmt.Errorf("tier %q is defined twice", tier.Name)
+		}
+		names[tier.Name] = true
+		if tier.Multiplier <= 0 {
+			return fmt.Errorf("tier %q multiplier must be positive", tier.Name)
+		}
+		if i > 0 && tier.MinAccrual <= t[i-1].MinAccrual {
+			return fmt.Errorf("tier %q threshold must be above %q", tier.Name, t[i-1].Name)
+		}
+	}
+	return nil
+}
+
+// For возвращает уровень для суммы начислений accrued
+func (t Table) For(accrued float64) Tier {
+	current := t[0]
+	for _, tier := range t[1:] {
+		if accrued >= tier.MinAccrual {
+			current = tier
+		}
+	}
+	return current
+}
+
+// Next возвращает следующий уровень после name
+func (t Table) Next(name string) (Tier, bool) {
+	for i, tier := range t {
+		if tier.Name == name && i+1 < len(t) {
+			return t[i+1], true
+		}
+	}
+	return Tier{}, false
+}
+
+// ByName возвращает уровень по имени. Неизвестное или пустое имя
+// (пользователь еще не пересчитан) означает первый уровень
+func (t Table) ByName(name string) Tier {
+	for _, tier := range t {
+		if tier.Name == name {
+			return tier
+		}
+	}
+	return t[0]
+}
+
+// Apply начисляет баллы с множителем уровня, amount - в копейках
+func (tier Tier) Apply(amount int) int {
+	return int(math.Round(float64(amount) * tier.Multiplier))
+}
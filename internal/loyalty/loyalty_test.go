@@ -0,0 +1,43 @@
+package loyalty
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	assert.NoError(t, Default.Validate())
+	assert.Equal(t, "BRONZE", Default.For(999.99).Name)
+	assert.Equal(t, "SILVER", Default.For(1000).Name)
+	assert.Equal(t, "GOLD", Default.For(100000).Name)
+	assert.Equal(t, "BRONZE", Default.ByName("").Name)
+
+	next, ok := Default.Next("SILVER")
+	assert.True(t, ok)
+	assert.Equal(t, "GOLD", next.Name)
+	_, ok = Default.Next("GOLD")
+	assert.False(t, ok)
+
+	assert.Equal(t, 1250, Default.ByName("SILVER").Apply(1000))
+	assert.Equal(t, 152, Default.ByName("GOLD").Apply(101))
+}
+
+func TestTableValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  Table
+		expErr string
+	}{
+		{"empty", Table{}, "at least one tier"},
+		{"first above zero", Table{{Name: "A", MinAccrual: 10, Multiplier: 1}}, "must start at 0"},
+		{"duplicate", Table{{Name: "A", Multiplier: 1}, {Name: "A", MinAccrual: 5, Multiplier: 2}}, "defined twice"},
+		{"not ascending", Table{{Name: "A", Multiplier: 1}, {Name: "B", MinAccrual: 10, Multiplier: 2}, {Name: "C", MinAccrual: 10, Multiplier: 3}}, "threshold"},
+		{"zero multiplier", Table{{Name: "A"}}, "multiplier"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorContains(t, test.table.Validate(), test.expErr)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package metrics описывает метрики сервиса в формате Prometheus
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "gophermart"
+
+// Исходы запросов к системе расчета баллов
+const (
+	AccrualOK          = "ok"
+	AccrualNotFound    = "not_registered"
+	AccrualRateLimited = "rate_limited"
+	AccrualBadStatus   = "bad_status"
+	AccrualError       = "error"
+	AccrualRejected    = "breaker_open"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Storage call latency by storage method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	AccrualRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_requests_total",
+		Help:      "Requests to the accrual system by outcome.",
+	}, []string{"outcome"})
+
+	AccrualBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "accrual_breaker_state",
+		Help:      "Accrual client circuit breaker state: 0 closed, 1 half-open, 2 open.",
+	})
+
+	AccrualBreakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_breaker_transitions_total",
+		Help:      "Accrual client circuit breaker state changes by target state.",
+	}, []string{"state"})
+
+	UnfinishedOrders = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unfinished_orders",
+		Help:      "Orders waiting for the accrual system (NEW and PROCESSING).",
+	})
+
+	PointsAccrued = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_accrued_total",
+		Help:      "Loyalty points credited to users.",
+	})
+
+	PointsWithdrawn = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_withdrawn_total",
+		Help:      "Loyalty points withdrawn by users.",
+	})
+
+	PointsTransferred = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_transferred_total",
+		Help:      "Loyalty points transferred between users.",
+	})
+
+	PointsReversed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_reversed_total",
+		Help:      "Loyalty points debited or put in debt by accrual reversals.",
+	})
+
+	PointsExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_expired_total",
+		Help:      "Loyalty points expired after their validity period.",
+	})
+
+	TierChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tier_changes_total",
+		Help:      "Loyalty tier changes by direction.",
+	}, []string{"direction"})
+
+	Registrations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Registered users.",
+	})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by route template.",
+	}, []string{"route"})
+)
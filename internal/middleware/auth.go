@@ -2,34 +2,28 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
 	"github.com/Azcarot/GopherMarketProject/internal/storage"
 )
 
 func CheckAuthorization(h http.Handler) http.Handler {
 	login := func(res http.ResponseWriter, req *http.Request) {
 		token := req.Header.Get("Authorization")
-		claims, ok := storage.VerifyToken(token)
-		if !ok {
-			res.WriteHeader(http.StatusUnauthorized)
+		userLogin, err := storage.Authenticate(token)
+		if errors.Is(err, storage.ErrUnauthorized) {
+			problem.Error(res, req, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 			return
 		}
-		var userData storage.UserData
-		userData.Login = claims["sub"].(string)
-		ok, err := storage.PgxStorage.CheckUserExists(storage.ST, userData)
 		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
+			problem.Internal(res, req, err)
 			return
 		}
-		if !ok {
-			res.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		ctx, cancel := context.WithTimeout(context.WithValue(req.Context(), storage.UserLoginCtxKey, userData.Login), 1000*time.Millisecond)
-		defer cancel()
-		req = req.WithContext(ctx)
+		ctx := logger.With(req.Context(), "login", userLogin)
+		req = req.WithContext(context.WithValue(ctx, storage.UserLoginCtxKey, userLogin))
 		h.ServeHTTP(res, req)
 	}
 	return http.HandlerFunc(login)
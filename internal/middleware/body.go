@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+)
+
+// LimitBody ограничивает размер тела запроса. Запросы с заведомо большим
+// Content-Length отклоняются сразу, остальные обрываются при чтении
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		limit := func(res http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > maxBytes {
+				problem.Error(res, req, http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge,
+					"request body must not exceed "+strconv.FormatInt(maxBytes, 10)+" bytes")
+				return
+			}
+			req.Body = http.MaxBytesReader(res, req.Body, maxBytes)
+			h.ServeHTTP(res, req)
+		}
+		return http.HandlerFunc(limit)
+	}
+}
+
+// RequireContentType пропускает только запросы с одним из указанных типов содержимого
+func RequireContentType(contentTypes ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(contentTypes))
+	for _, contentType := range contentTypes {
+		allowed[contentType] = true
+	}
+	detail := "Content-Type must be " + strings.Join(contentTypes, " or ")
+	return func(h http.Handler) http.Handler {
+		check := func(res http.ResponseWriter, req *http.Request) {
+			mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || !allowed[mediaType] {
+				problem.Error(res, req, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, detail)
+				return
+			}
+			h.ServeHTTP(res, req)
+		}
+		return http.HandlerFunc(check)
+	}
+}
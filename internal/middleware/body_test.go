@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimits(t *testing.T) {
+	handler := LimitBody(16)(RequireContentType("application/json")(http.HandlerFunc(
+		func(res http.ResponseWriter, req *http.Request) {
+			if _, err := io.ReadAll(req.Body); err != nil {
+				res.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			res.WriteHeader(http.StatusOK)
+		})))
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		chunked       bool
+		expStatus     int
+		expProblemHdr bool
+	}{
+		{"ok", "application/json; charset=utf-8", `{"a":1}`, false, http.StatusOK, false},
+		{"wrong type", "text/plain", `{"a":1}`, false, http.StatusUnsupportedMediaType, true},
+		{"missing type", "", `{"a":1}`, false, http.StatusUnsupportedMediaType, true},
+		{"too large", "application/json", strings.Repeat("1", 17), false, http.StatusRequestEntityTooLarge, true},
+		{"too large without length", "application/json", strings.Repeat("1", 17), true, http.StatusRequestEntityTooLarge, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(test.body))
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, test.expStatus, recorder.Code)
+			if test.expProblemHdr {
+				require.Equal(t, problem.ContentType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
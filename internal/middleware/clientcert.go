@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+)
+
+// RequireClientCert пропускает только запросы по TLS с клиентским
+// сертификатом, проверенным по CA из настройки tls_client_ca.
+// Ставится на маршруты партнеров и администраторов
+func RequireClientCert(h http.Handler) http.Handler {
+	clientCert := func(res http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+			problem.Error(res, req, http.StatusForbidden, problem.CodeClientCertRequired,
+				"a client certificate signed by the partner CA is required")
+			return
+		}
+		h.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(clientCert)
+}
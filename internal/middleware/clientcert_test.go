@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	handler := RequireClientCert(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name      string
+		tls       *tls.ConnectionState
+		expStatus int
+	}{
+		{"plain http", nil, http.StatusForbidden},
+		{"tls without client cert", &tls.ConnectionState{}, http.StatusForbidden},
+		{"verified client cert", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks", nil)
+			req.TLS = test.tls
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			assert.Equal(t, test.expStatus, res.Code)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+)
+
+// MinCompressSize - ответы меньшего размера не сжимаются
+const MinCompressSize = 1024
+
+// compressibleTypes - типы содержимого, которые имеет смысл сжимать
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"text/plain":               true,
+	"text/html":                true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+type (
+	// compressResponseWriter копит начало ответа, пока не станет ясно,
+	// стоит ли его сжимать
+	compressResponseWriter struct {
+		http.ResponseWriter
+		minSize  int
+		status   int
+		buf      []byte
+		gz       *gzip.Writer
+		decided  bool
+		compress bool
+	}
+)
+
+func (w *compressResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if !w.compressible() {
+			w.passthrough()
+			return w.ResponseWriter.Write(b)
+		}
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.compress {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) compressible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && compressibleTypes[mediaType]
+}
+
+// passthrough отправляет ответ без сжатия
+func (w *compressResponseWriter) passthrough() {
+	w.decided = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *compressResponseWriter) startCompression() error {
+	w.decided = true
+	w.compress = true
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Close дописывает ответ: короткие ответы отправляются без сжатия
+func (w *compressResponseWriter) Close() error {
+	if !w.decided {
+		w.passthrough()
+		if len(w.buf) > 0 {
+			_, err := w.ResponseWriter.Write(w.buf)
+			return err
+		}
+		return nil
+	}
+	if w.compress {
+		err := w.gz.Close()
+		gzipWriters.Put(w.gz)
+		return err
+	}
+	return nil
+}
+
+// WithCompression сжимает ответы gzip, если клиент это поддерживает, и
+// прозрачно распаковывает тела запросов с Content-Encoding: gzip
+func WithCompression(h http.Handler) http.Handler {
+	compressFn := func(res http.ResponseWriter, req *http.Request) {
+		switch encoding := strings.ToLower(req.Header.Get("Content-Encoding")); encoding {
+		case "", "identity":
+		case "gzip":
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				problem.Error(res, req, http.StatusBadRequest, problem.CodeInvalidRequest, "request body is not valid gzip")
+				return
+			}
+			defer gz.Close()
+			req.Body = gz
+			req.Header.Del("Content-Encoding")
+			req.Header.Del("Content-Length")
+			req.ContentLength = -1
+		default:
+			problem.Error(res, req, http.StatusUnsupportedMediaType, problem.CodeUnsupportedEncoding,
+				"unsupported request Content-Encoding "+strconv.Quote(encoding))
+			return
+		}
+		// WebSocket-соединения и клиенты без поддержки gzip обслуживаются как есть
+		if !acceptsGzip(req.Header.Get("Accept-Encoding")) || req.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(res, req)
+			return
+		}
+		res.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressResponseWriter{ResponseWriter: res, minSize: MinCompressSize}
+		defer cw.Close()
+		h.ServeHTTP(cw, req)
+	}
+	return http.HandlerFunc(compressFn)
+}
+
+// acceptsGzip разбирает Accept-Encoding с учетом q-значений
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		params = strings.ReplaceAll(params, " ", "")
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
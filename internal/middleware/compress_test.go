@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCompression(t *testing.T) {
+	large := "[" + strings.Repeat(`{"number":"9278923470","status":"PROCESSED"},`, 100) + "{}]"
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		expGzip        bool
+	}{
+		{"large json", "gzip, deflate", "application/json", large, true},
+		{"small json", "gzip", "application/json", `{"current":1}`, false},
+		{"no gzip support", "", "application/json", large, false},
+		{"gzip refused", "gzip;q=0", "application/json", large, false},
+		{"binary content", "gzip", "image/png", large, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := WithCompression(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Header().Set("Content-Type", test.contentType)
+				res.WriteHeader(http.StatusOK)
+				res.Write([]byte(test.body))
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			require.Equal(t, http.StatusOK, recorder.Code)
+			body := recorder.Body.Bytes()
+			if test.expGzip {
+				require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+				gz, err := gzip.NewReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				body, err = io.ReadAll(gz)
+				require.NoError(t, err)
+			} else {
+				require.Empty(t, recorder.Header().Get("Content-Encoding"))
+			}
+			require.Equal(t, test.body, string(body))
+		})
+	}
+}
+
+func TestWithCompressionDecompressesRequest(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("12345678903\n79927398713"))
+	gz.Close()
+
+	var received string
+	handler := WithCompression(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		received = string(data)
+		res.WriteHeader(http.StatusAccepted)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Equal(t, "12345678903\n79927398713", received)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "br")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+}
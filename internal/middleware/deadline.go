@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/go-chi/chi/v5"
+)
+
+// deadlineResponseWriter запоминает, начал ли обработчик ответ
+type deadlineResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *deadlineResponseWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *deadlineResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// RouteKey - ключ таблицы дедлайнов: метод и шаблон маршрута chi,
+// например "POST /api/user/orders/batch"
+func RouteKey(method, pattern string) string {
+	return method + " " + pattern
+}
+
+// WithDeadlines ограничивает время обработки запроса. Таймаут берется из
+// table по маршруту, найденному в routes, иначе используется defaultTimeout.
+// Нулевой таймаут отключает дедлайн (WebSocket). Если обработчик ничего
+// не ответил к дедлайну, клиент получает 504 в формате problem+json
+func WithDeadlines(routes chi.Routes, defaultTimeout time.Duration, table map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		deadline := func(res http.ResponseWriter, req *http.Request) {
+			timeout := defaultTimeout
+			routeCtx := chi.NewRouteContext()
+			if routes.Match(routeCtx, req.Method, req.URL.Path) {
+				if t, ok := table[RouteKey(req.Method, routeCtx.RoutePattern())]; ok {
+					timeout = t
+				}
+			}
+			if timeout <= 0 {
+				h.ServeHTTP(res, req)
+				return
+			}
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			dw := &deadlineResponseWriter{ResponseWriter: res}
+			h.ServeHTTP(dw, req.WithContext(ctx))
+			if !dw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				problem.Error(res, req, http.StatusGatewayTimeout, problem.CodeTimeout, "the request took too long to process")
+			}
+		}
+		return http.HandlerFunc(deadline)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDeadlines(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(WithDeadlines(r, 20*time.Millisecond, map[string]time.Duration{
+		RouteKey(http.MethodPost, "/api/user/orders/batch"): time.Second,
+		RouteKey(http.MethodGet, "/api/user/ws"):            0,
+	}))
+	// обработчик, который ждет отмены контекста и ничего не отвечает
+	wait := func(res http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+			res.WriteHeader(http.StatusOK)
+		}
+	}
+	r.Route("/api/user", func(r chi.Router) {
+		r.Get("/orders", wait)
+		r.Post("/orders/batch", wait)
+		r.Get("/ws", func(res http.ResponseWriter, req *http.Request) {
+			_, hasDeadline := req.Context().Deadline()
+			assert.False(t, hasDeadline)
+			res.WriteHeader(http.StatusOK)
+		})
+		r.Get("/slow-storage", func(res http.ResponseWriter, req *http.Request) {
+			<-req.Context().Done()
+			problem.Internal(res, req, context.DeadlineExceeded)
+		})
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		expStatus int
+	}{
+		{"default deadline", http.MethodGet, "/api/user/orders", http.StatusGatewayTimeout},
+		{"longer route deadline", http.MethodPost, "/api/user/orders/batch", http.StatusOK},
+		{"websocket is exempt", http.MethodGet, "/api/user/ws", http.StatusOK},
+		{"handler answers itself", http.MethodGet, "/api/user/slow-storage", http.StatusGatewayTimeout},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, httptest.NewRequest(test.method, test.url, nil))
+			assert.Equal(t, test.expStatus, res.Code)
+			if test.expStatus == http.StatusGatewayTimeout {
+				assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -1,14 +1,15 @@
 package middleware
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
 	"time"
 
-	"go.uber.org/zap"
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
 )
 
-var Sugar zap.SugaredLogger
-
 type (
 	// берём структуру для хранения сведений об ответе
 	responseData struct {
@@ -36,8 +37,19 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Hijack нужен для WebSocket-соединений, которые забирают соединение у http.Server
+func (r *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.responseData.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 // WithLogging добавляет дополнительный код для регистрации сведений о запросе
-// и возвращает новый http.Handler.
+// и возвращает новый http.Handler. Тело запроса не пишется, секретные
+// заголовки скрываются.
 func WithLogging(h http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -54,10 +66,11 @@ func WithLogging(h http.Handler) http.Handler {
 
 		duration := time.Since(start)
 
-		Sugar.Infoln(
+		logger.FromContext(r.Context()).Infow("request",
 			"uri", r.RequestURI,
 			"method", r.Method,
-			"body", r.Body,
+			"remote_addr", r.RemoteAddr,
+			"headers", logger.Headers(r.Header),
 			"status", responseData.status, // получаем перехваченный код статуса ответа
 			"duration", duration,
 			"size", responseData.size, // получаем перехваченный размер ответа
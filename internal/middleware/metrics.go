@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	// statusResponseWriter запоминает код ответа для метрик
+	statusResponseWriter struct {
+		http.ResponseWriter
+		status int
+	}
+)
+
+func (w *statusResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// WithMetrics считает запросы и их длительность. В метки попадает шаблон
+// маршрута chi, а не URI, чтобы число рядов не зависело от параметров пути
+func WithMetrics(h http.Handler) http.Handler {
+	metricsFn := func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: res}
+		h.ServeHTTP(sw, req)
+		route := routePattern(req)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		status := strconv.Itoa(sw.status)
+		metrics.HTTPRequests.WithLabelValues(req.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(req.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+	return http.HandlerFunc(metricsFn)
+}
+
+// routePattern возвращает шаблон маршрута chi, заполненный после маршрутизации
+func routePattern(req *http.Request) string {
+	if routeCtx := chi.RouteContext(req.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+		return routeCtx.RoutePattern()
+	}
+	return "unmatched"
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMetricsUsesRouteTemplate(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(WithMetrics)
+	r.Delete("/api/user/webhooks/{id}", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	counter := metrics.HTTPRequests.WithLabelValues(http.MethodDelete, "/api/user/webhooks/{id}", "204")
+	before := testutil.ToFloat64(counter)
+	for _, id := range []string{"1", "2", "3"} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/"+id, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, before+3, testutil.ToFloat64(counter))
+
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	before = testutil.ToFloat64(unmatched)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, before+1, testutil.ToFloat64(unmatched))
+}
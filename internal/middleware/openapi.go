@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+type (
+	// recordingResponseWriter задерживает ответ, пока он не будет проверен
+	recordingResponseWriter struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func (r *recordingResponseWriter) Header() http.Header {
+	return r.header
+}
+
+func (r *recordingResponseWriter) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *recordingResponseWriter) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+}
+
+// ValidateOpenAPI проверяет запросы и ответы на соответствие спецификации.
+// Запрос, не прошедший проверку, отклоняется с кодом 400, а расхождение
+// ответа со спецификацией записывается в лог
+func ValidateOpenAPI(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(h http.Handler) http.Handler {
+		validate := func(res http.ResponseWriter, req *http.Request) {
+			route, pathParams, err := router.FindRoute(req)
+			// Неописанные маршруты и WebSocket-соединения пропускаются как есть
+			if err != nil || strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+				h.ServeHTTP(res, req)
+				return
+			}
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				problem.Error(res, req, http.StatusBadRequest, problem.CodeValidationFailed, err.Error())
+				return
+			}
+			recorder := &recordingResponseWriter{header: res.Header()}
+			h.ServeHTTP(recorder, req)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			validateResponse(input, route, recorder)
+			res.WriteHeader(recorder.status)
+			res.Write(recorder.body.Bytes())
+		}
+		return http.HandlerFunc(validate)
+	}, nil
+}
+
+func validateResponse(input *openapi3filter.RequestValidationInput, route *routers.Route, recorder *recordingResponseWriter) {
+	output := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.status,
+		Header:                 recorder.header,
+		Body:                   io.NopCloser(bytes.NewReader(recorder.body.Bytes())),
+		Options:                input.Options,
+	}
+	if err := openapi3filter.ValidateResponse(input.Request.Context(), output); err != nil {
+		logger.FromContext(input.Request.Context()).Errorw("response does not match OpenAPI specification",
+			"method", route.Method,
+			"path", route.Path,
+			"status", recorder.status,
+			"error", err,
+		)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// RateLimit ограничивает частоту запросов к маршруту. Корзина выбирается
+// по маршруту и логину из CheckAuthorization, а без авторизации - по IP
+// клиента, поэтому middleware ставится после CheckAuthorization.
+// Лимит берется из table по RouteKey, иначе используется defaultLimit;
+// нулевой лимит отключает ограничение. Ответ несет заголовки
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, а при отказе -
+// 429 с Retry-After. Если хранилище недоступно, запрос пропускается
+func RateLimit(store ratelimit.Store, defaultLimit ratelimit.Limit, table map[string]ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		limiter := func(res http.ResponseWriter, req *http.Request) {
+			route := routePattern(req)
+			limit := defaultLimit
+			if l, ok := table[RouteKey(req.Method, route)]; ok {
+				limit = l
+			}
+			if !limit.Enabled() {
+				h.ServeHTTP(res, req)
+				return
+			}
+			key := RouteKey(req.Method, route) + " " + rateLimitSubject(req)
+			result, err := store.Take(req.Context(), key, limit)
+			if err != nil {
+				logger.FromContext(req.Context()).Warnw("rate limit store failed", "error", err)
+				h.ServeHTTP(res, req)
+				return
+			}
+			header := res.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(route).Inc()
+				header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				problem.Error(res, req, http.StatusTooManyRequests, problem.CodeRateLimited,
+					"too many requests, retry after "+ceilSeconds(result.RetryAfter)+" seconds")
+				return
+			}
+			h.ServeHTTP(res, req)
+		}
+		return http.HandlerFunc(limiter)
+	}
+}
+
+// rateLimitSubject - логин авторизованного пользователя или IP клиента
+func rateLimitSubject(req *http.Request) string {
+	if login, ok := req.Context().Value(storage.UserLoginCtxKey).(string); ok && login != "" {
+		return "login:" + login
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store is down")
+}
+
+func TestRateLimit(t *testing.T) {
+	ok := func(res http.ResponseWriter, req *http.Request) { res.WriteHeader(http.StatusOK) }
+	asUser := func(login string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				h.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, login)))
+			})
+		}
+	}
+	newRouter := func(store ratelimit.Store) *chi.Mux {
+		limit := RateLimit(store, ratelimit.Limit{Requests: 2, Period: time.Minute}, map[string]ratelimit.Limit{
+			RouteKey(http.MethodPost, "/login"): {Requests: 1, Period: time.Minute},
+			RouteKey(http.MethodGet, "/ws"):     {},
+		})
+		r := chi.NewRouter()
+		r.With(limit).Post("/login", ok)
+		r.With(asUser("alice"), limit).Get("/orders", ok)
+		r.With(asUser("bob"), limit).Get("/bob/orders", ok)
+		r.With(limit).Get("/ws", ok)
+		return r
+	}
+	do := func(r http.Handler, method, url, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.RemoteAddr = remote
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("per ip limit from table", func(t *testing.T) {
+		r := newRouter(ratelimit.NewMemoryStore())
+		res := do(r, http.MethodPost, "/login", "10.0.0.1:1000")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "1", res.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "60", res.Header().Get("RateLimit-Reset"))
+
+		res = do(r, http.MethodPost, "/login", "10.0.0.1:2000")
+		assert.Equal(t, http.StatusTooManyRequests, res.Code)
+		assert.Equal(t, "60", res.Header().Get("Retry-After"))
+		assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+		assert.Contains(t, res.Body.String(), problem.CodeRateLimited)
+
+		res = do(r, http.MethodPost, "/login", "10.0.0.2:1000")
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("per login default limit", func(t *testing.T) {
+		r := newRouter(ratelimit.NewMemoryStore())
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, do(r, http.MethodGet, "/orders", "10.0.0.1:1000").Code)
+		}
+		// тот же логин с другого адреса
+		assert.Equal(t, http.StatusTooManyRequests, do(r, http.MethodGet, "/orders", "10.0.0.2:1000").Code)
+		// другой пользователь с того же адреса
+		assert.Equal(t, http.StatusOK, do(r, http.MethodGet, "/bob/orders", "10.0.0.1:1000").Code)
+	})
+
+	t.Run("zero limit disables", func(t *testing.T) {
+		r := newRouter(ratelimit.NewMemoryStore())
+		for i := 0; i < 5; i++ {
+			res := do(r, http.MethodGet, "/ws", "10.0.0.1:1000")
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Empty(t, res.Header().Get("RateLimit-Limit"))
+		}
+	})
+
+	t.Run("store failure lets requests through", func(t *testing.T) {
+		r := newRouter(failingStore{})
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, do(r, http.MethodPost, "/login", "10.0.0.1:1000").Code)
+		}
+	})
+}
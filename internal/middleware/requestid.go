@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 64
+
+// WithRequestID присваивает запросу идентификатор (или берет его из заголовка
+// X-Request-ID клиента), кладет его в контекст и возвращает в ответе.
+// Логгер запроса получает поля request_id и trace_id
+func WithRequestID(h http.Handler) http.Handler {
+	requestID := func(res http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+		res.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(req.Context(), storage.RequestIDCtxKey, id)
+		fields := []interface{}{"request_id", id}
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+			fields = append(fields, "trace_id", spanCtx.TraceID().String())
+		}
+		ctx = logger.With(ctx, fields...)
+		h.ServeHTTP(res, req.WithContext(ctx))
+	}
+	return http.HandlerFunc(requestID)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// RequireRole пропускает пользователей с одной из ролей allowed и
+// запоминает в контексте первую подходящую. Ставится после CheckAuthorization
+func RequireRole(allowed ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		check := func(res http.ResponseWriter, req *http.Request) {
+			login, _ := req.Context().Value(storage.UserLoginCtxKey).(string)
+			for _, role := range allowed {
+				if login != "" && roles.Has(login, role) {
+					h.ServeHTTP(res, req.WithContext(roles.WithRole(req.Context(), role)))
+					return
+				}
+			}
+			problem.Error(res, req, http.StatusForbidden, problem.CodeForbidden, "the operation is not allowed for this user")
+		}
+		return http.HandlerFunc(check)
+	}
+}
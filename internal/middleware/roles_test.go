@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azcarot/GopherMarketProject/internal/problem"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	roles.Assign([]string{"root"}, []string{"shop"})
+	defer roles.Assign(nil, nil)
+	var gotRole string
+	h := RequireRole(roles.Admin, roles.Partner)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gotRole = roles.FromContext(req.Context())
+	}))
+
+	tests := []struct {
+		login     string
+		expStatus int
+		expRole   string
+	}{
+		{"root", http.StatusOK, roles.Admin},
+		{"shop", http.StatusOK, roles.Partner},
+		{"user", http.StatusForbidden, ""},
+		{"", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.login, func(t *testing.T) {
+			gotRole = ""
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/withdrawals/1/refund", nil)
+			if test.login != "" {
+				req = req.WithContext(context.WithValue(req.Context(), storage.UserLoginCtxKey, test.login))
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			assert.Equal(t, test.expStatus, res.Code)
+			assert.Equal(t, test.expRole, gotRole)
+			if test.expStatus == http.StatusForbidden {
+				assert.Contains(t, res.Body.String(), problem.CodeForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing открывает серверный спан на каждый запрос, продолжая трассу
+// из входящего traceparent. Имя спана уточняется шаблоном маршрута,
+// когда chi его определит
+func WithTracing(h http.Handler) http.Handler {
+	tracingFn := func(res http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(res, req)
+		route := routePattern(req)
+		span := trace.SpanFromContext(req.Context())
+		span.SetName(req.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+	return otelhttp.NewHandler(http.HandlerFunc(tracingFn), "http",
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return req.Method
+		}))
+}
@@ -7,6 +7,7 @@ package mock_storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	storage "github.com/Azcarot/GopherMarketProject/internal/storage"
 	gomock "github.com/golang/mock/gomock"
@@ -50,6 +51,21 @@ func (mr *MockPgxStorageMockRecorder) AddBalanceToUser(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBalanceToUser", reflect.TypeOf((*MockPgxStorage)(nil).AddBalanceToUser), arg0)
 }
 
+// CaptureHold mocks base method.
+func (m *MockPgxStorage) CaptureHold(arg0 context.Context, arg1 int64) (storage.WithdrawResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CaptureHold", arg0, arg1)
+	ret0, _ := ret[0].(storage.WithdrawResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CaptureHold indicates an expected call of CaptureHold.
+func (mr *MockPgxStorageMockRecorder) CaptureHold(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CaptureHold", reflect.TypeOf((*MockPgxStorage)(nil).CaptureHold), arg0, arg1)
+}
+
 // CheckIfOrderExists mocks base method.
 func (m *MockPgxStorage) CheckIfOrderExists(arg0 context.Context, arg1 storage.OrderData) (bool, bool, error) {
 	m.ctrl.T.Helper()
@@ -96,6 +112,36 @@ func (mr *MockPgxStorageMockRecorder) CheckUserPassword(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUserPassword", reflect.TypeOf((*MockPgxStorage)(nil).CheckUserPassword), arg0, arg1)
 }
 
+// ConfirmTransfer mocks base method.
+func (m *MockPgxStorage) ConfirmTransfer(arg0 context.Context, arg1 int64) (storage.TransferResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTransfer", arg0, arg1)
+	ret0, _ := ret[0].(storage.TransferResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTransfer indicates an expected call of ConfirmTransfer.
+func (mr *MockPgxStorageMockRecorder) ConfirmTransfer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTransfer", reflect.TypeOf((*MockPgxStorage)(nil).ConfirmTransfer), arg0, arg1)
+}
+
+// CreateHold mocks base method.
+func (m *MockPgxStorage) CreateHold(arg0 context.Context, arg1 storage.HoldRequest) (storage.HoldResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateHold", arg0, arg1)
+	ret0, _ := ret[0].(storage.HoldResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateHold indicates an expected call of CreateHold.
+func (mr *MockPgxStorageMockRecorder) CreateHold(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateHold", reflect.TypeOf((*MockPgxStorage)(nil).CreateHold), arg0, arg1)
+}
+
 // CreateNewOrder mocks base method.
 func (m *MockPgxStorage) CreateNewOrder(arg0 context.Context, arg1 storage.OrderData) error {
 	m.ctrl.T.Helper()
@@ -124,6 +170,21 @@ func (mr *MockPgxStorageMockRecorder) CreateNewUser(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNewUser", reflect.TypeOf((*MockPgxStorage)(nil).CreateNewUser), arg0, arg1)
 }
 
+// CreateOrdersBatch mocks base method.
+func (m *MockPgxStorage) CreateOrdersBatch(arg0 context.Context, arg1 []storage.OrderData) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrdersBatch", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrdersBatch indicates an expected call of CreateOrdersBatch.
+func (mr *MockPgxStorageMockRecorder) CreateOrdersBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrdersBatch", reflect.TypeOf((*MockPgxStorage)(nil).CreateOrdersBatch), arg0, arg1)
+}
+
 // CreateTablesForGopherStore mocks base method.
 func (m *MockPgxStorage) CreateTablesForGopherStore() {
 	m.ctrl.T.Helper()
@@ -136,6 +197,81 @@ func (mr *MockPgxStorageMockRecorder) CreateTablesForGopherStore() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTablesForGopherStore", reflect.TypeOf((*MockPgxStorage)(nil).CreateTablesForGopherStore))
 }
 
+// CreateTransfer mocks base method.
+func (m *MockPgxStorage) CreateTransfer(arg0 context.Context, arg1 storage.TransferRequest) (storage.TransferResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransfer", arg0, arg1)
+	ret0, _ := ret[0].(storage.TransferResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockPgxStorageMockRecorder) CreateTransfer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockPgxStorage)(nil).CreateTransfer), arg0, arg1)
+}
+
+// CreateWebhook mocks base method.
+func (m *MockPgxStorage) CreateWebhook(arg0 context.Context, arg1 storage.WebhookData) (storage.WebhookData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", arg0, arg1)
+	ret0, _ := ret[0].(storage.WebhookData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockPgxStorageMockRecorder) CreateWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockPgxStorage)(nil).CreateWebhook), arg0, arg1)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockPgxStorage) DeleteWebhook(arg0 context.Context, arg1 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockPgxStorageMockRecorder) DeleteWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockPgxStorage)(nil).DeleteWebhook), arg0, arg1)
+}
+
+// ExpirePoints mocks base method.
+func (m *MockPgxStorage) ExpirePoints(arg0 context.Context) ([]storage.ExpirationResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpirePoints", arg0)
+	ret0, _ := ret[0].([]storage.ExpirationResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpirePoints indicates an expected call of ExpirePoints.
+func (mr *MockPgxStorageMockRecorder) ExpirePoints(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpirePoints", reflect.TypeOf((*MockPgxStorage)(nil).ExpirePoints), arg0)
+}
+
+// GetAuditLog mocks base method.
+func (m *MockPgxStorage) GetAuditLog(arg0 context.Context, arg1 int) ([]storage.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditLog", arg0, arg1)
+	ret0, _ := ret[0].([]storage.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditLog indicates an expected call of GetAuditLog.
+func (mr *MockPgxStorageMockRecorder) GetAuditLog(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditLog", reflect.TypeOf((*MockPgxStorage)(nil).GetAuditLog), arg0, arg1)
+}
+
 // GetCustomerOrders mocks base method.
 func (m *MockPgxStorage) GetCustomerOrders(arg0 context.Context) ([]storage.OrderResponse, error) {
 	m.ctrl.T.Helper()
@@ -151,11 +287,101 @@ func (mr *MockPgxStorageMockRecorder) GetCustomerOrders(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCustomerOrders", reflect.TypeOf((*MockPgxStorage)(nil).GetCustomerOrders), arg0)
 }
 
+// GetExpirations mocks base method.
+func (m *MockPgxStorage) GetExpirations(arg0 context.Context) ([]storage.ExpirationResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpirations", arg0)
+	ret0, _ := ret[0].([]storage.ExpirationResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpirations indicates an expected call of GetExpirations.
+func (mr *MockPgxStorageMockRecorder) GetExpirations(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpirations", reflect.TypeOf((*MockPgxStorage)(nil).GetExpirations), arg0)
+}
+
+// GetPendingDeliveries mocks base method.
+func (m *MockPgxStorage) GetPendingDeliveries(arg0 context.Context, arg1 int) ([]storage.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingDeliveries", arg0, arg1)
+	ret0, _ := ret[0].([]storage.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingDeliveries indicates an expected call of GetPendingDeliveries.
+func (mr *MockPgxStorageMockRecorder) GetPendingDeliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingDeliveries", reflect.TypeOf((*MockPgxStorage)(nil).GetPendingDeliveries), arg0, arg1)
+}
+
+// GetRecentProcessedOrders mocks base method.
+func (m *MockPgxStorage) GetRecentProcessedOrders(arg0 context.Context, arg1 time.Duration) ([]storage.OrderData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecentProcessedOrders", arg0, arg1)
+	ret0, _ := ret[0].([]storage.OrderData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecentProcessedOrders indicates an expected call of GetRecentProcessedOrders.
+func (mr *MockPgxStorageMockRecorder) GetRecentProcessedOrders(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecentProcessedOrders", reflect.TypeOf((*MockPgxStorage)(nil).GetRecentProcessedOrders), arg0, arg1)
+}
+
+// GetTierHistory mocks base method.
+func (m *MockPgxStorage) GetTierHistory(arg0 context.Context) ([]storage.TierChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTierHistory", arg0)
+	ret0, _ := ret[0].([]storage.TierChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTierHistory indicates an expected call of GetTierHistory.
+func (mr *MockPgxStorageMockRecorder) GetTierHistory(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTierHistory", reflect.TypeOf((*MockPgxStorage)(nil).GetTierHistory), arg0)
+}
+
+// GetTransactions mocks base method.
+func (m *MockPgxStorage) GetTransactions(arg0 context.Context, arg1 storage.TxCursor, arg2 int) ([]storage.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransactions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]storage.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransactions indicates an expected call of GetTransactions.
+func (mr *MockPgxStorageMockRecorder) GetTransactions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockPgxStorage)(nil).GetTransactions), arg0, arg1, arg2)
+}
+
+// GetTransfers mocks base method.
+func (m *MockPgxStorage) GetTransfers(arg0 context.Context) ([]storage.TransferResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfers", arg0)
+	ret0, _ := ret[0].([]storage.TransferResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfers indicates an expected call of GetTransfers.
+func (mr *MockPgxStorageMockRecorder) GetTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfers", reflect.TypeOf((*MockPgxStorage)(nil).GetTransfers), arg0)
+}
+
 // GetUnfinishedOrders mocks base method.
-func (m *MockPgxStorage) GetUnfinishedOrders() ([]uint64, error) {
+func (m *MockPgxStorage) GetUnfinishedOrders() ([]storage.OrderData, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetUnfinishedOrders")
-	ret0, _ := ret[0].([]uint64)
+	ret0, _ := ret[0].([]storage.OrderData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -181,6 +407,21 @@ func (mr *MockPgxStorageMockRecorder) GetUserBalance(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBalance", reflect.TypeOf((*MockPgxStorage)(nil).GetUserBalance), arg0, arg1)
 }
 
+// GetWebhooks mocks base method.
+func (m *MockPgxStorage) GetWebhooks(arg0 context.Context) ([]storage.WebhookData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", arg0)
+	ret0, _ := ret[0].([]storage.WebhookData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockPgxStorageMockRecorder) GetWebhooks(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockPgxStorage)(nil).GetWebhooks), arg0)
+}
+
 // GetWithdrawals mocks base method.
 func (m *MockPgxStorage) GetWithdrawals(arg0 context.Context) ([]storage.WithdrawResponse, error) {
 	m.ctrl.T.Helper()
@@ -196,6 +437,95 @@ func (mr *MockPgxStorageMockRecorder) GetWithdrawals(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockPgxStorage)(nil).GetWithdrawals), arg0)
 }
 
+// RecalculateTiers mocks base method.
+func (m *MockPgxStorage) RecalculateTiers(arg0 context.Context) ([]storage.TierChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecalculateTiers", arg0)
+	ret0, _ := ret[0].([]storage.TierChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecalculateTiers indicates an expected call of RecalculateTiers.
+func (mr *MockPgxStorageMockRecorder) RecalculateTiers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecalculateTiers", reflect.TypeOf((*MockPgxStorage)(nil).RecalculateTiers), arg0)
+}
+
+// ReleaseExpiredHolds mocks base method.
+func (m *MockPgxStorage) ReleaseExpiredHolds(arg0 context.Context) ([]storage.HoldResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseExpiredHolds", arg0)
+	ret0, _ := ret[0].([]storage.HoldResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseExpiredHolds indicates an expected call of ReleaseExpiredHolds.
+func (mr *MockPgxStorageMockRecorder) ReleaseExpiredHolds(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseExpiredHolds", reflect.TypeOf((*MockPgxStorage)(nil).ReleaseExpiredHolds), arg0)
+}
+
+// ReleaseHold mocks base method.
+func (m *MockPgxStorage) ReleaseHold(arg0 context.Context, arg1 int64) (storage.HoldResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHold", arg0, arg1)
+	ret0, _ := ret[0].(storage.HoldResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseHold indicates an expected call of ReleaseHold.
+func (mr *MockPgxStorageMockRecorder) ReleaseHold(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHold", reflect.TypeOf((*MockPgxStorage)(nil).ReleaseHold), arg0, arg1)
+}
+
+// ReverseAccrual mocks base method.
+func (m *MockPgxStorage) ReverseAccrual(arg0 context.Context, arg1 storage.AccrualReversal) (storage.AccrualReversalResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseAccrual", arg0, arg1)
+	ret0, _ := ret[0].(storage.AccrualReversalResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseAccrual indicates an expected call of ReverseAccrual.
+func (mr *MockPgxStorageMockRecorder) ReverseAccrual(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseAccrual", reflect.TypeOf((*MockPgxStorage)(nil).ReverseAccrual), arg0, arg1)
+}
+
+// ReverseWithdrawal mocks base method.
+func (m *MockPgxStorage) ReverseWithdrawal(arg0 context.Context, arg1 storage.WithdrawalReversal) (storage.WithdrawResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseWithdrawal", arg0, arg1)
+	ret0, _ := ret[0].(storage.WithdrawResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseWithdrawal indicates an expected call of ReverseWithdrawal.
+func (mr *MockPgxStorageMockRecorder) ReverseWithdrawal(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseWithdrawal", reflect.TypeOf((*MockPgxStorage)(nil).ReverseWithdrawal), arg0, arg1)
+}
+
+// UpdateDelivery mocks base method.
+func (m *MockPgxStorage) UpdateDelivery(arg0 context.Context, arg1 storage.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDelivery", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateDelivery indicates an expected call of UpdateDelivery.
+func (mr *MockPgxStorageMockRecorder) UpdateDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDelivery", reflect.TypeOf((*MockPgxStorage)(nil).UpdateDelivery), arg0, arg1)
+}
+
 // UpdateOrder mocks base method.
 func (m *MockPgxStorage) UpdateOrder(arg0 context.Context, arg1 storage.OrderData) error {
 	m.ctrl.T.Helper()
@@ -211,11 +541,12 @@ func (mr *MockPgxStorageMockRecorder) UpdateOrder(arg0, arg1 interface{}) *gomoc
 }
 
 // WithdrawFromUser mocks base method.
-func (m *MockPgxStorage) WithdrawFromUser(arg0 context.Context, arg1 storage.WithdrawRequest) error {
+func (m *MockPgxStorage) WithdrawFromUser(arg0 context.Context, arg1 storage.WithdrawRequest) (storage.WithdrawResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "WithdrawFromUser", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(storage.WithdrawResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // WithdrawFromUser indicates an expected call of WithdrawFromUser.
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Типы событий, которые отправляются подписчикам
+const (
+	BalanceUpdated     = "balance.updated"
+	OrderUpdated       = "order.updated"
+	WithdrawalCreated  = "withdrawal.created"
+	WithdrawalReversed = "withdrawal.reversed"
+	OrderReversed      = "order.reversed"
+)
+
+const (
+	DefaultMaxConnsPerUser = 5
+	DefaultBufferSize      = 16
+)
+
+var ErrTooManyConnections = errors.New("too many connections for user")
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	Time string      `json:"time"`
+}
+
+// Subscriber - одно подключение пользователя к каналу уведомлений
+type Subscriber struct {
+	events     chan Event
+	done       chan struct{}
+	overflowed bool
+	once       sync.Once
+}
+
+// Events возвращает канал событий подписчика
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Done закрывается, когда подписчик отключен от хаба
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Overflowed сообщает, был ли подписчик отключен из-за переполнения буфера
+func (s *Subscriber) Overflowed() bool {
+	return s.overflowed
+}
+
+func (s *Subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// Hub хранит подписчиков по логину пользователя и рассылает им события
+type Hub struct {
+	mut         sync.Mutex
+	subscribers map[string]map[*Subscriber]struct{}
+	maxPerUser  int
+	bufferSize  int
+}
+
+func NewHub(maxPerUser int, bufferSize int) *Hub {
+	if maxPerUser <= 0 {
+		maxPerUser = DefaultMaxConnsPerUser
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		subscribers: make(map[string]map[*Subscriber]struct{}),
+		maxPerUser:  maxPerUser,
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscribe регистрирует новое подключение пользователя,
+// если лимит подключений для него еще не исчерпан
+func (h *Hub) Subscribe(login string) (*Subscriber, error) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	subs, ok := h.subscribers[login]
+	if !ok {
+		subs = make(map[*Subscriber]struct{})
+		h.subscribers[login] = subs
+	}
+	if len(subs) >= h.maxPerUser {
+		return nil, ErrTooManyConnections
+	}
+	sub := &Subscriber{
+		events: make(chan Event, h.bufferSize),
+		done:   make(chan struct{}),
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe отключает подписчика от хаба
+func (h *Hub) Unsubscribe(login string, sub *Subscriber) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.remove(login, sub)
+}
+
+func (h *Hub) remove(login string, sub *Subscriber) {
+	if subs, ok := h.subscribers[login]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subscribers, login)
+		}
+	}
+	sub.close()
+}
+
+// HasSubscribers позволяет не готовить данные события, если их некому отправить
+func (h *Hub) HasSubscribers(login string) bool {
+	if h == nil {
+		return false
+	}
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return len(h.subscribers[login]) > 0
+}
+
+// Publish отправляет событие всем подключениям пользователя.
+// Publish не блокируется: подписчик, не успевающий вычитывать события,
+// отключается от хаба
+func (h *Hub) Publish(login string, eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+	event := Event{
+		Type: eventType,
+		Data: data,
+		Time: time.Now().Format(time.RFC3339),
+	}
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	for sub := range h.subscribers[login] {
+		select {
+		case sub.events <- event:
+		default:
+			sub.overflowed = true
+			h.remove(login, sub)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+)
+
+// Default - хаб, через который HTTP и gRPC API отправляют события
+// пользователям. Заменяется при сборке роутера
+var Default = NewHub(DefaultMaxConnsPerUser, DefaultBufferSize)
+
+// PublishBalance отправляет пользователю актуальный баланс
+func PublishBalance(ctx context.Context, login string) {
+	if !Default.HasSubscribers(login) {
+		return
+	}
+	balance, err := storage.PgxStorage.GetUserBalance(storage.ST, ctx, storage.UserData{Login: login})
+	if err != nil {
+		return
+	}
+	balance.Accrual = balance.Accrual / 100
+	balance.Withdrawn = balance.Withdrawn / 100
+	balance.ExpiringSoon = balance.ExpiringSoon / 100
+	balance.Debt = balance.Debt / 100
+	balance.Held = balance.Held / 100
+	balance.Available = balance.Available / 100
+	Default.Publish(login, BalanceUpdated, balance)
+}
+
+// PublishWithdrawal сообщает пользователю о новом списании и изменении баланса
+func PublishWithdrawal(ctx context.Context, login string, withdrawal storage.WithdrawResponse) {
+	Default.Publish(login, WithdrawalCreated, withdrawal)
+	PublishBalance(ctx, login)
+}
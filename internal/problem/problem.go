@@ -0,0 +1,150 @@
+// Package problem формирует ответы об ошибках в формате RFC 7807
+// (application/problem+json)
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const ContentType = "application/problem+json"
+
+// Стабильные машиночитаемые коды ошибок
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeForbidden            = "forbidden"
+	CodeLoginTaken           = "login_taken"
+	CodeInvalidOrderNumber   = "invalid_order_number"
+	CodeOrderConflict        = "order_uploaded_by_another_user"
+	CodeInsufficientFunds    = "insufficient_funds"
+	CodeNotFound             = "not_found"
+	CodeRecipientNotFound    = "recipient_not_found"
+	CodeTransferLimit        = "transfer_limit_exceeded"
+	CodePointsOnHold         = "points_on_hold"
+	CodeTransferExpired      = "transfer_expired"
+	CodeTransferNotPending   = "transfer_not_pending"
+	CodeCancelWindowClosed   = "cancel_window_closed"
+	CodeAlreadyReversed      = "already_reversed"
+	CodeNothingToReverse     = "nothing_to_reverse"
+	CodeHoldNotActive        = "hold_not_active"
+	CodeHoldExpired          = "hold_expired"
+	CodeHoldExists           = "hold_exists"
+	CodeBatchTooLarge        = "batch_too_large"
+	CodeUnsupportedEncoding  = "unsupported_content_encoding"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeTooManyConnections   = "too_many_connections"
+	CodeClientCertRequired   = "client_certificate_required"
+	CodeRateLimited          = "rate_limited"
+	CodeTimeout              = "timeout"
+	CodeStorageUnavailable   = "storage_unavailable"
+	CodeInternal             = "internal_error"
+)
+
+const typePrefix = "urn:gophermart:problem:"
+
+// FieldError описывает ошибку в конкретном поле запроса
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Details struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func New(status int, code string, detail string) *Details {
+	return &Details{
+		Type:   typePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithErrors добавляет ошибки по полям запроса
+func (d *Details) WithErrors(errs ...FieldError) *Details {
+	d.Errors = append(d.Errors, errs...)
+	return d
+}
+
+// Write отправляет описание ошибки клиенту
+func Write(res http.ResponseWriter, req *http.Request, d *Details) {
+	d.Instance = req.URL.Path
+	if requestID, ok := req.Context().Value(storage.RequestIDCtxKey).(string); ok {
+		d.RequestID = requestID
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		res.WriteHeader(d.Status)
+		return
+	}
+	res.Header().Set("Content-Type", ContentType)
+	res.WriteHeader(d.Status)
+	res.Write(body)
+}
+
+// Error - сокращение для New и Write
+func Error(res http.ResponseWriter, req *http.Request, status int, code string, detail string) {
+	Write(res, req, New(status, code, detail))
+}
+
+// Internal отвечает на непредвиденную ошибку, не раскрывая ее текст клиенту.
+// Таймауты и недоступность базы отличаются от прочих ошибок сервера.
+// Сама ошибка пишется в лог запроса
+func Internal(res http.ResponseWriter, req *http.Request, err error) {
+	d := FromError(err)
+	logger.FromContext(req.Context()).Errorw("request failed",
+		"code", d.Code,
+		"status", d.Status,
+		"error", err,
+	)
+	Write(res, req, d)
+}
+
+func FromError(err error) *Details {
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(http.StatusGatewayTimeout, CodeTimeout, "the request took too long to process")
+	case errors.As(err, &connectErr), errors.As(err, &netErr), pgconn.SafeToRetry(err):
+		return New(http.StatusServiceUnavailable, CodeStorageUnavailable, "the storage is temporarily unavailable")
+	default:
+		return New(http.StatusInternalServerError, CodeInternal, "the request could not be processed")
+	}
+}
+
+// InvalidJSON разбирает ошибку json.Unmarshal и указывает поле с неверным типом
+func InvalidJSON(res http.ResponseWriter, req *http.Request, err error) {
+	d := New(http.StatusBadRequest, CodeInvalidJSON, "request body is not a valid JSON document")
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		d.WithErrors(FieldError{
+			Field:  typeErr.Field,
+			Code:   "invalid_type",
+			Detail: "expected " + typeErr.Type.String(),
+		})
+	}
+	Write(res, req, d)
+}
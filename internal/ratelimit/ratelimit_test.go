@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+	ctx := context.Background()
+
+	for i := 1; i >= 0; i-- {
+		res, err := store.Take(ctx, "user", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := store.Take(ctx, "user", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 2*time.Second, res.Reset)
+
+	// другой ключ - другая корзина
+	res, err = store.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// за секунду появляется один токен
+	now = now.Add(time.Second)
+	res, err = store.Take(ctx, "user", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := store.Take(ctx, "short", Limit{Requests: 1, Period: time.Second})
+	require.NoError(t, err)
+	_, err = store.Take(ctx, "long", Limit{Requests: 1, Period: time.Hour})
+	require.NoError(t, err)
+
+	now = now.Add(2 * sweepInterval)
+	_, err = store.Take(ctx, "short", Limit{Requests: 1, Period: time.Second})
+	require.NoError(t, err)
+	assert.Len(t, store.buckets, 2)
+	assert.Contains(t, store.buckets, "long", "bucket that is still refilling must survive the sweep")
+}
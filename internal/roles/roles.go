@@ -0,0 +1,65 @@
+// Package roles - роли пользователей. Администраторы и партнеры
+// перечисляются в конфигурации (admin_logins, partner_logins),
+// остальные пользователи имеют роль User
+package roles
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	User    = "user"
+	Admin   = "admin"
+	Partner = "partner"
+	// System - действия фоновых задач сервиса в журнале аудита
+	System = "system"
+)
+
+type ctxKey struct{}
+
+var (
+	mu       sync.RWMutex
+	assigned = map[string]map[string]bool{}
+)
+
+// Assign задает логины администраторов и партнеров
+func Assign(admins, partners []string) {
+	next := map[string]map[string]bool{}
+	add := func(logins []string, role string) {
+		for _, login := range logins {
+			if next[login] == nil {
+				next[login] = map[string]bool{}
+			}
+			next[login][role] = true
+		}
+	}
+	add(admins, Admin)
+	add(partners, Partner)
+	mu.Lock()
+	assigned = next
+	mu.Unlock()
+}
+
+// Has сообщает, есть ли у пользователя роль. Роль User есть у всех
+func Has(login string, role string) bool {
+	if role == User {
+		return true
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return assigned[login][role]
+}
+
+// WithRole запоминает в контексте роль, с которой действует пользователь
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, role)
+}
+
+// FromContext возвращает роль из контекста, по умолчанию User
+func FromContext(ctx context.Context) string {
+	if role, ok := ctx.Value(ctxKey{}).(string); ok {
+		return role
+	}
+	return User
+}
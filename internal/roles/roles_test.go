@@ -0,0 +1,23 @@
+package roles
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	Assign([]string{"root"}, []string{"shop", "root"})
+	defer Assign(nil, nil)
+
+	assert.True(t, Has("root", Admin))
+	assert.True(t, Has("root", Partner))
+	assert.True(t, Has("shop", Partner))
+	assert.False(t, Has("shop", Admin))
+	assert.True(t, Has("anyone", User))
+	assert.False(t, Has("anyone", Partner))
+
+	assert.Equal(t, User, FromContext(context.Background()))
+	assert.Equal(t, Admin, FromContext(WithRole(context.Background(), Admin)))
+}
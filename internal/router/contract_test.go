@@ -0,0 +1,361 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/openapi"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	mountRoutes(r, utils.Flags{})
+	mounted := make(map[string]bool)
+	err = chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		mounted[method+" "+route] = true
+		path := doc.Paths.Find(route)
+		require.NotNil(t, path, "route %s is missing in the OpenAPI spec", route)
+		require.NotNil(t, path.GetOperation(method), "operation %s %s is missing in the OpenAPI spec", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+	for route, path := range doc.Paths.Map() {
+		for method := range path.Operations() {
+			require.True(t, mounted[method+" "+route], "operation %s %s is documented but not mounted", method, route)
+		}
+	}
+}
+
+func TestHandlersMatchSpec(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	specRouter, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	mountRoutes(r, utils.Flags{})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(storage.JWTSecret))
+	require.NoError(t, err)
+	roles.Assign([]string{"user"}, nil)
+	defer roles.Assign(nil, nil)
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		expect      func(mock *mock_storage.MockPgxStorageMockRecorder)
+		expStatus   int
+	}{
+		{
+			name: "register", method: http.MethodPost, url: "/api/user/register",
+			contentType: "application/json", body: `{"login":"new","password":"secret"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CheckUserExists(gomock.Any()).Return(false, nil)
+				mock.CreateNewUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "register conflict", method: http.MethodPost, url: "/api/user/register",
+			contentType: "application/json", body: `{"login":"user","password":"secret"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CheckUserExists(gomock.Any()).Return(true, nil)
+			},
+			expStatus: http.StatusConflict,
+		},
+		{
+			name: "orders", method: http.MethodGet, url: "/api/user/orders",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetCustomerOrders(gomock.Any()).Return([]storage.OrderResponse{
+					{OrderNumber: "9278923470", Accrual: 500, State: "PROCESSED", Date: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "balance", method: http.MethodGet, url: "/api/user/balance",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetUserBalance(gomock.Any(), gomock.Any()).Return(storage.BalanceResponce{Accrual: 50050, Withdrawn: 4200}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "withdrawals", method: http.MethodGet, url: "/api/user/withdrawals",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetWithdrawals(gomock.Any()).Return([]storage.WithdrawResponse{
+					{OrderNumber: "2377225624", Amount: 500, ProcessedAt: "2020-12-09T16:09:57+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "withdraw without funds", method: http.MethodPost, url: "/api/user/balance/withdraw",
+			contentType: "application/json", body: `{"order":"2377225624","sum":751}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.WithdrawFromUser(gomock.Any(), gomock.Any()).Return(storage.WithdrawResponse{}, storage.ErrInsufficientFunds)
+			},
+			expStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "batch", method: http.MethodPost, url: "/api/user/orders/batch",
+			contentType: "application/json", body: `["12345678903", "12345678904"]`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateOrdersBatch(gomock.Any(), gomock.Any()).Return([]string{storage.BatchAccepted}, nil)
+			},
+			expStatus: http.StatusAccepted,
+		},
+		{
+			name: "transfer", method: http.MethodPost, url: "/api/user/balance/transfer",
+			contentType: "application/json", body: `{"to":"mom","sum":100}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateTransfer(gomock.Any(), gomock.Any()).Return(storage.TransferResponse{
+					ID: 1, From: "user", To: "mom", Direction: storage.TransferOut, Amount: 100,
+					State: storage.TransferCompleted, CreatedAt: "2020-12-10T15:15:45+03:00", CompletedAt: "2020-12-10T15:15:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "transfer pending", method: http.MethodPost, url: "/api/user/balance/transfer",
+			contentType: "application/json", body: `{"to":"mom","sum":600}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateTransfer(gomock.Any(), gomock.Any()).Return(storage.TransferResponse{
+					ID: 2, From: "user", To: "mom", Direction: storage.TransferOut, Amount: 600,
+					State: storage.TransferPending, CreatedAt: "2020-12-10T15:15:45+03:00", ExpiresAt: "2020-12-10T15:30:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusAccepted,
+		},
+		{
+			name: "transfer limit", method: http.MethodPost, url: "/api/user/balance/transfer",
+			contentType: "application/json", body: `{"to":"mom","sum":100}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateTransfer(gomock.Any(), gomock.Any()).Return(storage.TransferResponse{}, storage.ErrTransferLimit)
+			},
+			expStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "confirm transfer", method: http.MethodPost, url: "/api/user/balance/transfer/2/confirm",
+			contentType: "application/json", body: `{"password":"secret"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CheckUserPassword(gomock.Any(), gomock.Any()).Return(true, nil)
+				mock.ConfirmTransfer(gomock.Any(), int64(2)).Return(storage.TransferResponse{}, storage.ErrTransferExpired)
+			},
+			expStatus: http.StatusGone,
+		},
+		{
+			name: "transfers", method: http.MethodGet, url: "/api/user/balance/transfers",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetTransfers(gomock.Any()).Return([]storage.TransferResponse{
+					{ID: 1, From: "mom", To: "user", Direction: storage.TransferIn, Amount: 100,
+						State: storage.TransferCompleted, CreatedAt: "2020-12-10T15:15:45+03:00", CompletedAt: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "hold", method: http.MethodPost, url: "/api/user/balance/holds",
+			contentType: "application/json", body: `{"order":"2377225624","sum":100}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateHold(gomock.Any(), gomock.Any()).Return(storage.HoldResponse{
+					ID: 3, Login: "user", OrderNumber: "2377225624", Amount: 100, State: storage.HoldActive,
+					CreatedAt: "2020-12-10T15:15:45+03:00", ExpiresAt: "2020-12-10T15:30:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusCreated,
+		},
+		{
+			name: "hold without funds", method: http.MethodPost, url: "/api/user/balance/holds",
+			contentType: "application/json", body: `{"order":"2377225624","sum":751}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateHold(gomock.Any(), gomock.Any()).Return(storage.HoldResponse{}, storage.ErrInsufficientFunds)
+			},
+			expStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "capture hold", method: http.MethodPost, url: "/api/user/balance/holds/3/capture",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CaptureHold(gomock.Any(), int64(3)).Return(storage.WithdrawResponse{
+					Login: "user", OrderNumber: "2377225624", Amount: 100, ProcessedAt: "2020-12-10T15:20:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "release expired hold", method: http.MethodPost, url: "/api/user/balance/holds/3/release",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.ReleaseHold(gomock.Any(), int64(3)).Return(storage.HoldResponse{}, storage.ErrHoldExpired)
+			},
+			expStatus: http.StatusGone,
+		},
+		{
+			name: "transactions", method: http.MethodGet, url: "/api/user/transactions?limit=1",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetTransactions(gomock.Any(), storage.TxCursor{}, 1).Return([]storage.Transaction{
+					{Cursor: "MTYwNzYwMjU0NTAwMDAwMDowOjE", Type: storage.TxAccrual, OrderNumber: "9278923470",
+						Amount: 500, Balance: 500, CreatedAt: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "transactions bad cursor", method: http.MethodGet, url: "/api/user/transactions?after=broken",
+			expect:    func(mock *mock_storage.MockPgxStorageMockRecorder) {},
+			expStatus: http.StatusBadRequest,
+		},
+		{
+			name: "refund", method: http.MethodPost, url: "/api/admin/withdrawals/2377225624/refund",
+			contentType: "application/json", body: `{"reason":"order cancelled"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.ReverseWithdrawal(gomock.Any(), gomock.Any()).Return(storage.WithdrawResponse{
+					Login: "mom", OrderNumber: "2377225624", Amount: 500, ProcessedAt: "2020-12-09T16:09:57+03:00",
+					Status: storage.OrderReversed, ReversedAt: "2020-12-10T15:15:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "reverse accrual", method: http.MethodPost, url: "/api/admin/orders/9278923470/reverse",
+			contentType: "application/json", body: `{"reason":"goods returned","sum":200}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.ReverseAccrual(gomock.Any(), gomock.Any()).Return(storage.AccrualReversalResponse{
+					Login: "mom", OrderNumber: "9278923470", Amount: 200, Debited: 150, Debt: 50,
+					Status: "PROCESSED", ReversedAt: "2020-12-10T15:15:45+03:00",
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "reverse missing order", method: http.MethodPost, url: "/api/admin/orders/9278923470/reverse",
+			contentType: "application/json", body: `{"reason":"goods returned"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.ReverseAccrual(gomock.Any(), gomock.Any()).Return(storage.AccrualReversalResponse{}, storage.ErrOrderNotFound)
+			},
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name: "expirations", method: http.MethodGet, url: "/api/user/balance/expirations",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetExpirations(gomock.Any()).Return([]storage.ExpirationResponse{
+					{OrderNumber: "9278923470", Amount: 500, AccruedAt: "2019-12-10T15:15:45+03:00", ExpiredAt: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "tier history", method: http.MethodGet, url: "/api/user/balance/tier-history",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetTierHistory(gomock.Any()).Return([]storage.TierChange{
+					{From: "BRONZE", To: "SILVER", Direction: storage.TierUpgrade, Accrued: 1000, ChangedAt: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "webhook", method: http.MethodPost, url: "/api/user/webhooks",
+			contentType: "application/json", body: `{"url":"https://93.184.216.34/hook"}`,
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.CreateWebhook(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, data storage.WebhookData) (storage.WebhookData, error) {
+					data.ID = 4
+					return data, nil
+				})
+			},
+			expStatus: http.StatusCreated,
+		},
+		{
+			name: "webhook to internal address", method: http.MethodPost, url: "/api/user/webhooks",
+			contentType: "application/json", body: `{"url":"http://127.0.0.1/hook"}`,
+			expect:    func(mock *mock_storage.MockPgxStorageMockRecorder) {},
+			expStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "webhooks", method: http.MethodGet, url: "/api/user/webhooks",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.GetWebhooks(gomock.Any()).Return([]storage.WebhookData{
+					{ID: 4, URL: "https://93.184.216.34/hook", Date: "2020-12-10T15:15:45+03:00"},
+				}, nil)
+			},
+			expStatus: http.StatusOK,
+		},
+		{
+			name: "delete webhook", method: http.MethodDelete, url: "/api/user/webhooks/4",
+			expect: func(mock *mock_storage.MockPgxStorageMockRecorder) {
+				mock.DeleteWebhook(gomock.Any(), int64(4)).Return(false, nil)
+			},
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name: "spec", method: http.MethodGet, url: "/api/openapi.json",
+			expect:    func(mock *mock_storage.MockPgxStorageMockRecorder) {},
+			expStatus: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := mock_storage.NewMockPgxStorage(ctrl)
+			storage.ST = mock
+			mock.EXPECT().CheckUserExists(storage.UserData{Login: "user"}).Return(true, nil).AnyTimes()
+			test.expect(mock.EXPECT())
+
+			req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			req.Header.Set("Authorization", token)
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			require.Equal(t, test.expStatus, recorder.Code)
+
+			specReq := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if test.contentType != "" {
+				specReq.Header.Set("Content-Type", test.contentType)
+			}
+			route, pathParams, err := specRouter.FindRoute(specReq)
+			require.NoError(t, err)
+			input := &openapi3filter.RequestValidationInput{
+				Request:    specReq,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+					IncludeResponseStatus: true,
+				},
+			}
+			require.NoError(t, openapi3filter.ValidateRequest(context.Background(), input))
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 recorder.Code,
+				Header:                 recorder.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(recorder.Body.Bytes())),
+				Options:                input.Options,
+			})
+			require.NoError(t, err)
+		})
+	}
+}
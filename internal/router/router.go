@@ -4,46 +4,204 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/accrual"
 	"github.com/Azcarot/GopherMarketProject/internal/handlers"
+	"github.com/Azcarot/GopherMarketProject/internal/health"
 	"github.com/Azcarot/GopherMarketProject/internal/middleware"
+	"github.com/Azcarot/GopherMarketProject/internal/notify"
+	"github.com/Azcarot/GopherMarketProject/internal/openapi"
+	"github.com/Azcarot/GopherMarketProject/internal/ratelimit"
+	"github.com/Azcarot/GopherMarketProject/internal/roles"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/Azcarot/GopherMarketProject/internal/webhook"
 	"github.com/go-chi/chi/v5"
-	"go.uber.org/zap"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var Flag utils.Flags
 
+// RateLimitStore хранит корзины ограничителя частоты запросов.
+// При нескольких экземплярах сервиса заменяется общим хранилищем
+var RateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+
 func MakeRouter(flag utils.Flags) *chi.Mux {
+	notify.Default = notify.NewHub(flag.FlagWSMaxConns, notify.DefaultBufferSize)
+	r := chi.NewRouter()
+	roles.Assign(flag.FlagAdminLogins, flag.FlagPartnerLogins)
+	handlers.CancelWindow = flag.FlagWithdrawalCancelWindow
+	handlers.RecheckWindow = flag.FlagAccrualRecheckWindow
+	handlers.Accrual = accrual.NewClient(flag.FlagAccrualAddr, flag.FlagAccrualTimeout, accrual.BreakerConfig{
+		FailureThreshold: flag.FlagAccrualBreakerFailures,
+		OpenTimeout:      flag.FlagAccrualBreakerTimeout,
+		HalfOpenProbes:   flag.FlagAccrualBreakerProbes,
+	})
+	runEvery(flag.FlagPollInterval, handlers.ActualiseOrders)
+	runEvery(flag.FlagPollInterval, webhook.DeliverPending)
+	if flag.FlagPointsExpiryMonths > 0 {
+		runEvery(flag.FlagPointsExpiryInterval, handlers.ExpirePoints)
+	}
+	if flag.FlagAccrualRecheckWindow > 0 {
+		runEvery(flag.FlagAccrualRecheckInterval, handlers.RecheckOrders)
+	}
+	runEvery(flag.FlagHoldSweepInterval, handlers.ReleaseExpiredHolds)
+	runDailyAt(flag.FlagTierRecalcAt, handlers.RecalculateTiers)
+	r.Use(middleware.WithTracing)
+	r.Use(middleware.WithRequestID)
+	r.Use(middleware.WithLogging)
+	r.Use(middleware.WithMetrics)
+	r.Use(middleware.WithCompression)
+	r.Use(middleware.WithDeadlines(r, flag.FlagRequestTimeout, routeTimeouts(flag)))
+	if flag.FlagDevMode {
+		doc, err := openapi.Load()
+		if err != nil {
+			panic(err)
+		}
+		validator, err := middleware.ValidateOpenAPI(doc)
+		if err != nil {
+			panic(err)
+		}
+		r.Use(validator)
+	}
+	mountRoutes(r, flag)
+	r.Handle("/metrics", promhttp.Handler())
+	health.Register("database", storage.Ping)
+	health.Register("migrations", storage.CheckMigrations)
+	health.Register("accrual", handlers.Accrual.Breaker().Check)
+	r.Get("/healthz", health.Liveness)
+	r.Get("/readyz", health.Readiness)
+	return r
+}
+
+// Ограничения размера тела запроса по маршрутам
+const (
+	maxAuthBody    = 4 << 10
+	maxOrderBody   = 1 << 10
+	maxBatchBody   = 1 << 20
+	maxDefaultBody = 4 << 10
+)
+
+// defaultRouteTimeouts - дедлайны маршрутов, отличные от request_timeout.
+// Перекрываются настройкой route_timeouts
+var defaultRouteTimeouts = map[string]time.Duration{
+	middleware.RouteKey(http.MethodPost, "/api/user/orders/batch"): 30 * time.Second,
+	// соединение WebSocket живет без дедлайна
+	middleware.RouteKey(http.MethodGet, "/api/user/ws"): 0,
+}
+
+func routeTimeouts(flag utils.Flags) map[string]time.Duration {
+	table := make(map[string]time.Duration, len(defaultRouteTimeouts)+len(flag.FlagRouteTimeouts))
+	for route, timeout := range defaultRouteTimeouts {
+		table[route] = timeout
+	}
+	for route, timeout := range flag.FlagRouteTimeouts {
+		table[route] = timeout
+	}
+	return table
+}
+
+// defaultRateLimits - лимиты маршрутов, отличные от rate_limit.
+// Перекрываются настройкой rate_limits
+var defaultRateLimits = map[string]utils.RateLimit{
+	// подбор паролей ограничивается по IP
+	middleware.RouteKey(http.MethodPost, "/api/user/register"): {Requests: 10, Period: time.Minute},
+	middleware.RouteKey(http.MethodPost, "/api/user/login"):    {Requests: 10, Period: time.Minute},
+	middleware.RouteKey(http.MethodPost, "/api/user/orders"):   {Requests: 30, Period: time.Minute},
+	// подтверждение перевода проверяет пароль
+	middleware.RouteKey(http.MethodPost, "/api/user/balance/transfer/{id}/confirm"): {Requests: 5, Period: time.Minute},
+}
+
+// RateLimits - лимиты маршрутов по RouteKey с учетом настройки rate_limits.
+// Ими же ограничиваются вход и регистрация через gRPC
+func RateLimits(flag utils.Flags) map[string]ratelimit.Limit {
+	table := make(map[string]ratelimit.Limit, len(defaultRateLimits)+len(flag.FlagRateLimits))
+	for route, limit := range defaultRateLimits {
+		table[route] = ratelimit.Limit(limit)
+	}
+	for route, limit := range flag.FlagRateLimits {
+		table[route] = ratelimit.Limit(limit)
+	}
+	return table
+}
+
+// mountRoutes описывает маршруты API. Каждый маршрут должен быть
+// описан в internal/openapi/openapi.json
+func mountRoutes(r chi.Router, flag utils.Flags) {
+	// маршруты партнеров и администраторов требуют клиентский сертификат, если задан CA
+	partner := chi.Chain()
+	if flag.FlagTLSClientCA != "" {
+		partner = chi.Chain(middleware.RequireClientCert)
+	}
+	// лимит ставится после CheckAuthorization, чтобы считать запросы по логину
+	limit := middleware.RateLimit(RateLimitStore, ratelimit.Limit(flag.FlagRateLimit), RateLimits(flag))
+	jsonBody := middleware.RequireContentType("application/json")
+	textBody := middleware.RequireContentType("text/plain")
+	batchBody := middleware.RequireContentType("application/json", "text/plain")
+	r.Get("/api/openapi.json", http.HandlerFunc(openapi.Handler))
+	r.Route("/api/user", func(r chi.Router) {
+		r.With(limit, middleware.LimitBody(maxAuthBody), jsonBody).Post("/register", http.HandlerFunc(handlers.Registration))
+		r.With(limit, middleware.LimitBody(maxAuthBody), jsonBody).Post("/login", http.HandlerFunc(handlers.LoginUser))
+		r.With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxOrderBody), textBody).Post("/orders", http.HandlerFunc(handlers.Order))
+		r.With(partner...).With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxBatchBody), batchBody).Post("/orders/batch", http.HandlerFunc(handlers.OrderBatch))
+		r.With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/balance/withdraw", http.HandlerFunc(handlers.Withdraw))
+		r.With(middleware.CheckAuthorization, limit).Get("/orders", http.HandlerFunc(handlers.GetOrders))
+		r.With(middleware.CheckAuthorization, limit).Get("/balance", http.HandlerFunc(handlers.GetBalance))
+		r.With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/balance/transfer", http.HandlerFunc(handlers.Transfer))
+		r.With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxAuthBody), jsonBody).Post("/balance/transfer/{id}/confirm", http.HandlerFunc(handlers.ConfirmTransfer))
+		r.With(middleware.CheckAuthorization, limit).Get("/balance/transfers", http.HandlerFunc(handlers.GetTransfers))
+		r.With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/balance/holds", http.HandlerFunc(handlers.CreateHold))
+		r.With(middleware.CheckAuthorization, limit).Post("/balance/holds/{id}/capture", http.HandlerFunc(handlers.CaptureHold))
+		r.With(middleware.CheckAuthorization, limit).Post("/balance/holds/{id}/release", http.HandlerFunc(handlers.ReleaseHold))
+		r.With(middleware.CheckAuthorization, limit).Get("/balance/expirations", http.HandlerFunc(handlers.GetExpirations))
+		r.With(middleware.CheckAuthorization, limit).Get("/balance/tier-history", http.HandlerFunc(handlers.GetTierHistory))
+		r.With(middleware.CheckAuthorization, limit).Get("/withdrawals", http.HandlerFunc(handlers.GetWithdrawals))
+		r.With(middleware.CheckAuthorization, limit).Get("/transactions", http.HandlerFunc(handlers.GetTransactions))
+		r.With(middleware.CheckAuthorization, limit).Post("/withdrawals/{order}/cancel", http.HandlerFunc(handlers.CancelWithdrawal))
+		r.With(middleware.CheckAuthorization, limit).Get("/ws", http.HandlerFunc(handlers.Notifications))
+		// вебхуки регистрируют системы партнеров, маршруты описаны в спецификации как партнерские
+		r.With(partner...).With(middleware.CheckAuthorization, limit, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/webhooks", http.HandlerFunc(handlers.CreateWebhook))
+		r.With(partner...).With(middleware.CheckAuthorization, limit).Get("/webhooks", http.HandlerFunc(handlers.GetWebhooks))
+		r.With(partner...).With(middleware.CheckAuthorization, limit).Delete("/webhooks/{id}", http.HandlerFunc(handlers.DeleteWebhook))
+	})
+	r.Route("/api/admin", func(r chi.Router) {
+		staff := middleware.RequireRole(roles.Admin, roles.Partner)
+		admin := middleware.RequireRole(roles.Admin)
+		r.With(partner...).With(middleware.CheckAuthorization, limit, staff, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/withdrawals/{order}/refund", http.HandlerFunc(handlers.RefundWithdrawal))
+		r.With(partner...).With(middleware.CheckAuthorization, limit, staff, middleware.LimitBody(maxDefaultBody), jsonBody).Post("/orders/{order}/reverse", http.HandlerFunc(handlers.ReverseAccrual))
+		r.With(partner...).With(middleware.CheckAuthorization, limit, admin).Get("/audit", http.HandlerFunc(handlers.GetAuditLog))
+	})
+}
+
+// runEvery запускает фоновую задачу с заданным периодом
+func runEvery(period time.Duration, job func()) {
+	ticker := time.NewTicker(period)
+	go func() {
+		for range ticker.C {
+			job()
+		}
+	}()
+}
 
-	logger, err := zap.NewDevelopment()
+// runDailyAt запускает фоновую задачу каждый день в заданное время
+// (ЧЧ:ММ, местное время). Формат проверен при загрузке конфигурации
+func runDailyAt(clock string, job func()) {
+	at, err := time.Parse(utils.TimeOfDayLayout, clock)
 	if err != nil {
-		panic(err)
+		return
 	}
-	defer logger.Sync()
-	middleware.Sugar = *logger.Sugar()
-	r := chi.NewRouter()
-	ticker := time.NewTicker(2 * time.Second)
-	quit := make(chan struct{})
 	go func() {
 		for {
-			select {
-			case <-ticker.C:
-				handlers.ActualiseOrders(flag)
-			case <-quit:
-				ticker.Stop()
-				return
-			}
+			time.Sleep(time.Until(nextDaily(time.Now(), at)))
+			job()
 		}
 	}()
-	r.Use(middleware.WithLogging)
-	r.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", http.HandlerFunc(handlers.Registration))
-		r.Post("/login", http.HandlerFunc(handlers.LoginUser))
-		r.With(middleware.CheckAuthorization).Post("/orders", http.HandlerFunc(handlers.Order))
-		r.With(middleware.CheckAuthorization).Post("/balance/withdraw", http.HandlerFunc(handlers.Withdraw))
-		r.With(middleware.CheckAuthorization).Get("/orders", http.HandlerFunc(handlers.GetOrders))
-		r.With(middleware.CheckAuthorization).Get("/balance", http.HandlerFunc(handlers.GetBalance))
-		r.With(middleware.CheckAuthorization).Get("/withdrawals", http.HandlerFunc(handlers.GetWithdrawals))
-	})
-	return r
+}
+
+// nextDaily возвращает ближайший после now момент со временем суток at
+func nextDaily(now time.Time, at time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
 }
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDaily(t *testing.T) {
+	at := time.Date(0, 1, 1, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		exp  time.Time
+	}{
+		{"later today", time.Date(2026, 3, 10, 1, 30, 0, 0, time.UTC), time.Date(2026, 3, 10, 3, 0, 0, 0, time.UTC)},
+		{"already passed", time.Date(2026, 3, 10, 3, 0, 0, 0, time.UTC), time.Date(2026, 3, 11, 3, 0, 0, 0, time.UTC)},
+		{"month end", time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.exp, nextDaily(test.now, at))
+		})
+	}
+}
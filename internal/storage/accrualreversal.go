@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/jackc/pgx/v5"
+)
+
+// OrderReversed - состояние заказа, начисление по которому отменено целиком
+const OrderReversed = "REVERSED"
+
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrNothingToReverse = errors.New("order has no accrual to reverse")
+	ErrReversalTooLarge = errors.New("reversal exceeds the order accrual")
+)
+
+// AccrualReversal - запрос на отмену начисления по заказу при возврате
+type AccrualReversal struct {
+	OrderNumber uint64
+	// сколько баллов системы расчета отменить, в копейках;
+	// 0 - все еще не отмененное начисление
+	Amount int
+	Actor  string
+	Role   string
+	Reason string
+}
+
+// AccrualReversalResponse - результат отмены начисления. Sum - отмененное
+// начисление системы расчета, Debited - списано с баланса с учетом
+// множителя уровня, Debt - сколько не хватило на балансе и записано в долг
+type AccrualReversalResponse struct {
+	Login       string  `json:"-"`
+	OrderNumber string  `json:"order"`
+	Amount      float64 `json:"sum"`
+	Debited     float64 `json:"debited"`
+	Debt        float64 `json:"debt,omitempty"`
+	Status      string  `json:"status"`
+	ReversedAt  string  `json:"reversed_at"`
+}
+
+// ReverseAccrual отменяет начисление по заказу целиком или частично.
+// Баллы списываются сначала из партии заказа, затем из остальных партий;
+// если их уже потратили, недостающее записывается пользователю в долг
+func (store SQLStore) ReverseAccrual(ctx context.Context, reversal AccrualReversal) (_ AccrualReversalResponse, err error) {
+	defer observe(ctx, "ReverseAccrual")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	result := AccrualReversalResponse{OrderNumber: strconv.FormatUint(reversal.OrderNumber, 10)}
+	var accrual, reversed int
+	err = tx.QueryRow(ctx, `SELECT customer, accrual_points, reversed, state
+	FROM orders
+	WHERE order_number = $1 AND withdrawal = 0
+	FOR UPDATE`, reversal.OrderNumber).Scan(&result.Login, &accrual, &reversed, &result.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AccrualReversalResponse{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	left := accrual - reversed
+	if result.Status != "PROCESSED" || left <= 0 {
+		return AccrualReversalResponse{}, ErrNothingToReverse
+	}
+	amount := reversal.Amount
+	if amount == 0 {
+		amount = left
+	}
+	if amount > left {
+		return AccrualReversalResponse{}, ErrReversalTooLarge
+	}
+	// начислено было с множителем уровня, списывается в той же пропорции.
+	// У заказов, начисленных до появления партий, партии нет
+	var lotID int64
+	var lotAmount, lotRemaining int
+	debit := amount
+	err = tx.QueryRow(ctx, `SELECT id, amount, remaining
+	FROM accrual_lots
+	WHERE customer = $1 AND order_number = $2 AND base_amount > 0
+	FOR UPDATE`, result.Login, reversal.OrderNumber).Scan(&lotID, &lotAmount, &lotRemaining)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return AccrualReversalResponse{}, err
+	default:
+		debit = reversalDebit(lotAmount, amount, accrual)
+	}
+	var balance int
+	err = tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1 FOR UPDATE`, result.Login).Scan(&balance)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	// зарезервированные баллы не списываются, иначе резерв нельзя будет списать
+	held, err := heldPoints(ctx, tx, result.Login)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	fromLot, covered, debt := splitReversal(debit, lotRemaining, balance-held)
+	// amount партии остается в истории операций, base_amount уменьшается
+	// для расчета уровня программы лояльности
+	if lotID != 0 {
+		_, err = tx.Exec(ctx, `UPDATE accrual_lots
+		SET base_amount = base_amount - $1, remaining = remaining - $2
+		WHERE id = $3`, amount, fromLot, lotID)
+		if err != nil {
+			return AccrualReversalResponse{}, err
+		}
+	}
+	if covered > 0 {
+		if _, err = consumeLots(ctx, tx, result.Login, balance-fromLot, covered); err != nil {
+			return AccrualReversalResponse{}, err
+		}
+	}
+	_, err = tx.Exec(ctx, `UPDATE users
+	SET accrual_points = accrual_points - $1, debt = debt + $2
+	WHERE login = $3`, fromLot+covered, debt, result.Login)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	if reversed+amount == accrual {
+		result.Status = OrderReversed
+	}
+	_, err = tx.Exec(ctx, `UPDATE orders SET reversed = reversed + $1, state = $2
+	WHERE order_number = $3 AND withdrawal = 0`, amount, result.Status, reversal.OrderNumber)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, `INSERT INTO accrual_reversals
+	(customer, order_number, amount, debited, debt, actor, role, reason, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		result.Login, reversal.OrderNumber, amount, fromLot+covered, debt, reversal.Actor, reversal.Role, reversal.Reason, now)
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	result.Amount = float64(amount) / 100
+	result.Debited = float64(fromLot+covered) / 100
+	result.Debt = float64(debt) / 100
+	details, err := json.Marshal(map[string]any{
+		"sum":     result.Amount,
+		"debited": result.Debited,
+		"debt":    result.Debt,
+		"reason":  reversal.Reason,
+	})
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	err = writeAudit(ctx, tx, AuditEntry{
+		Actor:   reversal.Actor,
+		Role:    reversal.Role,
+		Action:  AuditAccrualReversed,
+		Subject: result.Login,
+		Object:  result.OrderNumber,
+		Details: string(details),
+	})
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	err = enqueueWebhook(ctx, tx, result.Login, WebhookPayload{
+		Event:       WebhookOrderReversed,
+		OrderNumber: result.OrderNumber,
+		Status:      result.Status,
+		Sum:         result.Amount,
+	})
+	if err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return AccrualReversalResponse{}, err
+	}
+	metrics.PointsReversed.Add(result.Debited + result.Debt)
+	result.ReversedAt = now.Format(time.RFC3339)
+	return result, nil
+}
+
+// reversalDebit - сколько списать с баланса при отмене amount из accrual
+// начисления системы расчета, если по заказу зачислено lotAmount
+func reversalDebit(lotAmount, amount, accrual int) int {
+	return int(math.Round(float64(lotAmount) * float64(amount) / float64(accrual)))
+}
+
+// splitReversal делит списание debit на часть из партии заказа, часть из
+// остальных партий и долг. С баланса списывается не больше available -
+// баланса за вычетом резервов
+func splitReversal(debit, lotRemaining, available int) (fromLot, covered, debt int) {
+	available = max(available, 0)
+	fromLot = min(lotRemaining, debit, available)
+	covered = min(debit-fromLot, available-fromLot)
+	debt = debit - fromLot - covered
+	return fromLot, covered, debt
+}
+
+// GetRecentProcessedOrders возвращает заказы, начисленные за последние window,
+// для повторной сверки с системой расчета. Accrual - еще не отмененная часть
+func (store SQLStore) GetRecentProcessedOrders(ctx context.Context, window time.Duration) (_ []OrderData, err error) {
+	defer observe(ctx, "GetRecentProcessedOrders")(&err)
+	rows, err := store.DB.Query(ctx, `SELECT o.order_number, o.customer, o.accrual_points - o.reversed
+	FROM orders o
+	JOIN accrual_lots l ON l.order_number = o.order_number AND l.customer = o.customer
+	WHERE o.withdrawal = 0 AND o.state = 'PROCESSED' AND o.accrual_points > o.reversed
+	AND l.base_amount > 0 AND l.accrued_at > $1`, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []OrderData
+	for rows.Next() {
+		var order OrderData
+		if err := rows.Scan(&order.OrderNumber, &order.User, &order.Accrual); err != nil {
+			return result, err
+		}
+		result = append(result, order)
+	}
+	return result, rows.Err()
+}
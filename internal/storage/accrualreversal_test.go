@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReversalDebit(t *testing.T) {
+	assert.Equal(t, 1000, reversalDebit(1000, 1000, 1000), "full reversal without a multiplier")
+	assert.Equal(t, 550, reversalDebit(1100, 500, 1000), "half of a 1.1x accrual")
+	assert.Equal(t, 38, reversalDebit(115, 33, 100), "rounded to the nearest cent")
+}
+
+func TestSplitReversal(t *testing.T) {
+	tests := []struct {
+		name         string
+		debit        int
+		lotRemaining int
+		available    int
+		expFromLot   int
+		expCovered   int
+		expDebt      int
+	}{
+		{"from the order lot", 500, 1000, 2000, 500, 0, 0},
+		{"lot partly spent", 500, 200, 2000, 200, 300, 0},
+		{"balance short", 500, 200, 300, 200, 100, 200},
+		{"everything spent", 500, 0, 0, 0, 0, 500},
+		{"held points stay", 500, 500, 100, 100, 0, 400},
+		{"holds over balance", 500, 500, -50, 0, 0, 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fromLot, covered, debt := splitReversal(test.debit, test.lotRemaining, test.available)
+			assert.Equal(t, test.expFromLot, fromLot)
+			assert.Equal(t, test.expCovered, covered)
+			assert.Equal(t, test.expDebt, debt)
+			assert.Equal(t, test.debit, fromLot+covered+debt)
+		})
+	}
+}
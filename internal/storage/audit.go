@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Действия, записываемые в журнал аудита
+const (
+	AuditWithdrawalReversed = "withdrawal.reversed"
+	AuditAccrualReversed    = "accrual.reversed"
+)
+
+// AuditEntry - запись журнала аудита: кто (actor) в какой роли
+// что сделал (action) с чьими данными (subject) и каким объектом (object)
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	Actor     string `json:"actor"`
+	Role      string `json:"role"`
+	Action    string `json:"action"`
+	Subject   string `json:"subject"`
+	Object    string `json:"object"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// writeAudit пишет запись аудита в рамках транзакции изменения
+func writeAudit(ctx context.Context, tx pgx.Tx, entry AuditEntry) error {
+	_, err := tx.Exec(ctx, `INSERT INTO audit_log 
+	(actor, role, action, subject, object, details, created_at) 
+	VALUES ($1, $2, $3, $4, $5, $6, now())`,
+		entry.Actor, entry.Role, entry.Action, entry.Subject, entry.Object, entry.Details)
+	return err
+}
+
+// GetAuditLog возвращает последние limit записей аудита, от новых к старым
+func (store SQLStore) GetAuditLog(ctx context.Context, limit int) (_ []AuditEntry, err error) {
+	defer observe(ctx, "GetAuditLog")(&err)
+	rows, err := store.DB.Query(ctx, `SELECT id, actor, role, action, subject, object, details, created_at 
+	FROM audit_log 
+	ORDER BY id DESC 
+	LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var createdAt time.Time
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Role, &entry.Action, &entry.Subject, &entry.Object, &entry.Details, &createdAt); err != nil {
+			return result, err
+		}
+		entry.CreatedAt = createdAt.Format(time.RFC3339)
+		result = append(result, entry)
+	}
+	return result, rows.Err()
+}
@@ -2,30 +2,59 @@ package storage
 
 import (
 	"context"
-	"fmt"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/jackc/pgx/v5"
 )
 
-func (store SQLStore) AddBalanceToUser(orderData OrderData) (bool, error) {
+func (store SQLStore) AddBalanceToUser(orderData OrderData) (_ bool, err error) {
+	defer observe(context.Background(), "AddBalanceToUser")(&err)
 	ctx := context.Background()
-	sqlQuery := fmt.Sprintf(`SELECT users.accrual_points, users.login 
+	// строка пользователя блокируется до конца транзакции, чтобы
+	// параллельные начисления и списания не потеряли обновление
+	sqlQuery := `SELECT users.accrual_points, users.login, COALESCE(users.tier, ''), users.debt 
 	FROM users
 	LEFT JOIN orders  
 	ON users.login = orders.customer 
-	WHERE orders.order_number = '%d'`, orderData.OrderNumber)
-	var currentBalance int
-	var login string
+	WHERE orders.order_number = $1
+	FOR UPDATE OF users`
+	var currentBalance, debt int
+	var login, tier string
 
-	err := store.DB.QueryRow(ctx, sqlQuery).Scan(&currentBalance, &login)
+	tx, err := store.DB.Begin(ctx)
 	if err != nil {
 		return false, err
 	}
-	currentBalance += orderData.Accrual
-	tx, err := store.DB.Begin(ctx)
+	err = tx.QueryRow(ctx, sqlQuery, orderData.OrderNumber).Scan(&currentBalance, &login, &tier, &debt)
+	if err != nil {
+		tx.Rollback(ctx)
+		return false, err
+	}
+	// баллы системы расчета зачисляются с множителем уровня пользователя
+	credited := Tiers.ByName(tier).Apply(orderData.Accrual)
+	currentBalance += credited
+	err = addAccrualLot(ctx, tx, login, orderData.OrderNumber, credited, orderData.Accrual)
 	if err != nil {
+		tx.Rollback(ctx)
 		return false, err
 	}
-	sql := `UPDATE users SET accrual_points = $1 WHERE login = $2`
-	_, err = store.DB.Exec(ctx, sql, currentBalance, login)
+	// долг от отмененных начислений гасится из новых баллов, начиная со старых партий
+	repay := min(debt, credited)
+	if repay > 0 {
+		if _, err = consumeLots(ctx, tx, login, currentBalance, repay); err != nil {
+			tx.Rollback(ctx)
+			return false, err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO balance_adjustments (customer, order_number, amount, reason, created_at) 
+		VALUES ($1, $2, $3, $4, now())`, login, orderData.OrderNumber, -repay, AdjustmentDebtRepayment)
+		if err != nil {
+			tx.Rollback(ctx)
+			return false, err
+		}
+	}
+	sql := `UPDATE users SET accrual_points = accrual_points + $1, debt = debt - $2 WHERE login = $3`
+	_, err = tx.Exec(ctx, sql, credited-repay, repay, login)
 	if err != nil {
 		tx.Rollback(ctx)
 		return false, err
@@ -35,100 +64,148 @@ func (store SQLStore) AddBalanceToUser(orderData OrderData) (bool, error) {
 		tx.Rollback(ctx)
 		return false, err
 	}
+	metrics.PointsAccrued.Add(float64(credited) / 100)
 	return true, nil
 }
 
-func (store SQLStore) GetUserBalance(ctx context.Context, data UserData) (BalanceResponce, error) {
-	var sql string
+func (store SQLStore) GetUserBalance(ctx context.Context, data UserData) (_ BalanceResponce, err error) {
+	defer observe(ctx, "GetUserBalance")(&err)
 	var result BalanceResponce
-	for {
-		select {
-		case <-ctx.Done():
-			return result, errTimeout
-		default:
-			sql = fmt.Sprintf(`SELECT accrual_points, withdrawal FROM users WHERE login = '%s'`, data.Login)
-
-			err := store.DB.QueryRow(ctx, sql).Scan(&result.Accrual, &result.Withdrawn)
-			if err != nil {
-				return result, err
-			}
-			return result, nil
-		}
+	err = store.DB.QueryRow(ctx, `SELECT accrual_points, withdrawal, debt FROM users WHERE login = $1`, data.Login).
+		Scan(&result.Accrual, &result.Withdrawn, &result.Debt)
+	if err != nil {
+		return result, err
+	}
+	if err = store.expiringSoon(ctx, data.Login, &result); err != nil {
+		return result, err
 	}
+	held, err := heldPoints(ctx, store.DB, data.Login)
+	if err != nil {
+		return result, err
+	}
+	result.Held = float64(held)
+	result.Available = result.Accrual - result.Held
+	result.Tier, err = store.tierInfo(ctx, data.Login)
+	return result, err
 
 }
 
-func (store SQLStore) WithdrawFromUser(ctx context.Context, withdraw WithdrawRequest) error {
-	if userLogin, ok := ctx.Value(UserLoginCtxKey).(string); ok {
-		for {
-			select {
-			case <-ctx.Done():
-				return errTimeout
-			default:
-				var balance BalanceResponce
-				getBalanceSQL := fmt.Sprintf(`SELECT accrual_points, withdrawal FROM users WHERE login = '%s'`, userLogin)
-				tx, err := store.DB.Begin(ctx)
-				if err != nil {
-					return err
-				}
-				err = store.DB.QueryRow(ctx, getBalanceSQL).Scan(&balance.Accrual, &balance.Withdrawn)
-				if err != nil {
-					return err
-				}
-				currentBalance := int(balance.Accrual)
-				if int(currentBalance) < int(withdraw.Amount*100) {
-					return fmt.Errorf("payment required")
-				}
-				currentBalance -= int(withdraw.Amount * 100)
-				currentWithdrawn := int(balance.Withdrawn) + int(withdraw.Amount*100)
-				sql := `UPDATE users SET accrual_points = $1, withdrawal = $2 WHERE login = $3`
-				_, err = store.DB.Exec(ctx, sql, currentBalance, currentWithdrawn, userLogin)
-				if err != nil {
-					tx.Rollback(ctx)
-					return err
-				}
-				err = tx.Commit(ctx)
-				if err != nil {
-					tx.Rollback(ctx)
-					return err
-				}
-				return nil
-			}
+// WithdrawFromUser списывает баллы в счет заказа и записывает списание
+// в заказы в той же транзакции
+func (store SQLStore) WithdrawFromUser(ctx context.Context, withdraw WithdrawRequest) (_ WithdrawResponse, err error) {
+	defer observe(ctx, "WithdrawFromUser")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return WithdrawResponse{}, ErrNoLogin
+	}
+	amount := Cents(withdraw.Amount)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	var balance int
+	err = tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1 FOR UPDATE`, userLogin).Scan(&balance)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	// зарезервированные баллы недоступны для списания
+	held, err := heldPoints(ctx, tx, userLogin)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	if balance-held < amount {
+		return WithdrawResponse{}, ErrInsufficientFunds
+	}
+	now := time.Now()
+	if err = debitPoints(ctx, tx, userLogin, balance, withdraw.OrderNumber, amount, now); err != nil {
+		return WithdrawResponse{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return WithdrawResponse{}, err
+	}
+	metrics.PointsWithdrawn.Add(float64(amount) / 100)
+	return WithdrawResponse{
+		Login:       userLogin,
+		OrderNumber: withdraw.OrderNumber,
+		Amount:      float64(amount) / 100,
+		ProcessedAt: now.Format(time.RFC3339),
+		Status:      WithdrawalProcessed,
+	}, nil
+}
 
+// debitPoints списывает amount с баланса и из партий в счет заказа,
+// записывает списание в заказы и ставит событие вебхука. balance -
+// баланс, прочитанный в транзакции
+func debitPoints(ctx context.Context, tx pgx.Tx, login string, balance int, orderNumber string, amount int, at time.Time) error {
+	parts, err := consumeLots(ctx, tx, login, balance, amount)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE users 
+	SET accrual_points = accrual_points - $1, withdrawal = withdrawal + $1 
+	WHERE login = $2`, amount, login)
+	if err != nil {
+		return err
+	}
+	var withdrawalID int64
+	err = tx.QueryRow(ctx, `INSERT INTO orders
+	(order_number, accrual_points, state, customer, withdrawal, created, created_at)
+	VALUES ($1::bigint, 0, 'NEW', $2, $3, $4, $5)
+	RETURNING id`, orderNumber, login, amount, at.Format(time.RFC3339), at).Scan(&withdrawalID)
+	if err != nil {
+		return err
+	}
+	// списанные партии запоминаются по списанию, чтобы при его отмене
+	// вернуть баллы именно в них
+	for _, part := range parts {
+		if part.lotID == 0 {
+			continue
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO withdrawal_lots (withdrawal_id, lot_id, amount) 
+		VALUES ($1, $2, $3)`, withdrawalID, part.lotID, part.amount)
+		if err != nil {
+			return err
 		}
 	}
-	return ErrNoLogin
+	return enqueueWebhook(ctx, tx, login, WebhookPayload{
+		Event:       WebhookWithdrawalCreated,
+		OrderNumber: orderNumber,
+		Sum:         float64(amount) / 100,
+	})
 }
 
-func (store SQLStore) GetWithdrawals(ctx context.Context) ([]WithdrawResponse, error) {
+func (store SQLStore) GetWithdrawals(ctx context.Context) (_ []WithdrawResponse, err error) {
+	defer observe(ctx, "GetWithdrawals")(&err)
 	var result []WithdrawResponse
 	if userLogin, ok := ctx.Value(UserLoginCtxKey).(string); ok {
-		for {
-			select {
-			case <-ctx.Done():
-				return result, errTimeout
-			default:
-				sqlQuery := fmt.Sprintf(`SELECT order_number, withdrawal, created FROM orders WHERE customer = '%s' and withdrawal > 0 ORDER BY id DESC`, userLogin)
-				rows, err := store.DB.Query(ctx, sqlQuery)
-				if err != nil {
-					return nil, err
-				}
-				defer rows.Close()
-				for rows.Next() {
-					var order WithdrawResponse
-					if err := rows.Scan(&order.OrderNumber, &order.Amount, &order.ProcessedAt); err != nil {
-						return result, err
-					}
-					order.Amount = order.Amount / 100
-					result = append(result, order)
-				}
-				if err = rows.Err(); err != nil {
-					return result, err
-				}
-				return result, nil
-
+		rows, err := store.DB.Query(ctx, `SELECT o.order_number, o.withdrawal, o.created, r.created_at 
+		FROM orders o 
+		LEFT JOIN withdrawal_reversals r ON r.withdrawal_id = o.id 
+		WHERE o.customer = $1 and o.withdrawal > 0 
+		ORDER BY o.id DESC`, userLogin)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var order WithdrawResponse
+			var reversedAt *time.Time
+			if err := rows.Scan(&order.OrderNumber, &order.Amount, &order.ProcessedAt, &reversedAt); err != nil {
+				return result, err
 			}
+			order.Amount = order.Amount / 100
+			order.Status = WithdrawalProcessed
+			if reversedAt != nil {
+				order.Status = WithdrawalReversed
+				order.ReversedAt = reversedAt.Format(time.RFC3339)
+			}
+			result = append(result, order)
+		}
+		if err = rows.Err(); err != nil {
+			return result, err
 		}
+		return result, nil
 
 	}
 	return result, ErrNoLogin
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetWithdrawalsQuotedLogin(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "o'hara", 10000)
+	_, err := store.WithdrawFromUser(userContext("o'hara"), WithdrawRequest{OrderNumber: "2377225624", Amount: 30})
+	require.NoError(t, err)
+
+	withdrawals, err := store.GetWithdrawals(userContext("o'hara"))
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "2377225624", withdrawals[0].OrderNumber)
+	assert.Equal(t, 30.0, withdrawals[0].Amount)
+	assert.Equal(t, WithdrawalProcessed, withdrawals[0].Status)
+}
+
+func TestGetUserBalanceQuotedLogin(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "o'hara", 10000)
+	_, err := store.DB.Exec(userContext("o'hara"), `UPDATE users SET debt = 500 WHERE login = $1`, "o'hara")
+	require.NoError(t, err)
+
+	balance, err := store.GetUserBalance(userContext("o'hara"), UserData{Login: "o'hara"})
+	require.NoError(t, err)
+	assert.Equal(t, 10000.0, balance.Accrual)
+	assert.Equal(t, 500.0, balance.Debt)
+	assert.Equal(t, 10000.0, balance.Available)
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore подключается к базе из TEST_DATABASE_URI и пересоздает
+// таблицы. Без переменной тесты с базой пропускаются
+func testStore(t *testing.T) SQLStore {
+	t.Helper()
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	pool, err := pgxpool.New(context.Background(), uri)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	store := SQLStore{DB: pool}
+	store.CreateTablesForGopherStore()
+	require.NoError(t, CheckMigrations(context.Background()))
+	return store
+}
+
+// addTestUser создает пользователя с балансом points в копейках
+func addTestUser(t *testing.T, store SQLStore, login string, points int) {
+	t.Helper()
+	_, err := store.DB.Exec(context.Background(), `INSERT INTO users (login, password, accrual_points, withdrawal)
+	VALUES ($1, '', $2, 0)`, login, points)
+	require.NoError(t, err)
+}
+
+func userBalance(t *testing.T, store SQLStore, login string) int {
+	t.Helper()
+	var balance int
+	err := store.DB.QueryRow(context.Background(), `SELECT accrual_points FROM users WHERE login = $1`, login).Scan(&balance)
+	require.NoError(t, err)
+	return balance
+}
+
+// addTestLot добавляет партию начисления возрастом age и возвращает ее id
+func addTestLot(t *testing.T, store SQLStore, login string, amount int, age time.Duration) int64 {
+	t.Helper()
+	var id int64
+	err := store.DB.QueryRow(context.Background(), `INSERT INTO accrual_lots
+	(customer, order_number, amount, base_amount, remaining, accrued_at)
+	VALUES ($1, 0, $2, $2, $2, now() - make_interval(secs => $3))
+	RETURNING id`, login, amount, age.Seconds()).Scan(&id)
+	require.NoError(t, err)
+	return id
+}
+
+func lotRemaining(t *testing.T, store SQLStore, id int64) int {
+	t.Helper()
+	var remaining int
+	err := store.DB.QueryRow(context.Background(), `SELECT remaining FROM accrual_lots WHERE id = $1`, id).Scan(&remaining)
+	require.NoError(t, err)
+	return remaining
+}
+
+func userContext(login string) context.Context {
+	return context.WithValue(context.Background(), UserLoginCtxKey, login)
+}
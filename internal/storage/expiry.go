@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PointsExpiryMonths - через сколько месяцев после начисления сгорают
+// баллы, 0 - не сгорают. Задается конфигурацией (points_expiry_months)
+var PointsExpiryMonths int
+
+// ExpiringSoonWindow - горизонт, на котором баланс показывает
+// скоро сгорающие баллы (points_expiring_window)
+var ExpiringSoonWindow = 30 * 24 * time.Hour
+
+// ExpirationResponse - сгоревший остаток одного начисления
+type ExpirationResponse struct {
+	Login string `json:"-"`
+	// номер заказа начисления, пуст для баллов, полученных переводом
+	OrderNumber string  `json:"order,omitempty"`
+	Amount      float64 `json:"sum"`
+	AccruedAt   string  `json:"accrued_at"`
+	ExpiredAt   string  `json:"expired_at"`
+}
+
+// addAccrualLot записывает начисление как партию баллов со сроком сгорания.
+// amount - зачисленные баллы, base - начисление системы расчета без множителя
+func addAccrualLot(ctx context.Context, tx pgx.Tx, login string, orderNumber uint64, amount int, base int) error {
+	_, err := tx.Exec(ctx, `INSERT INTO accrual_lots 
+	(customer, order_number, amount, base_amount, remaining, accrued_at, expires_at) 
+	VALUES ($1, $2, $3, $4, $3, now(), CASE WHEN $5::int > 0 THEN now() + make_interval(months => $5::int) END)`,
+		login, orderNumber, amount, base, PointsExpiryMonths)
+	return err
+}
+
+// lotOrder - номер заказа партии, 0 у партий из переводов
+func lotOrder(number uint64) string {
+	if number == 0 {
+		return ""
+	}
+	return strconv.FormatUint(number, 10)
+}
+
+// lotPart - списанная часть партии и ее срок сгорания (nil - не сгорает).
+// lotID равен 0 для баллов, начисленных до появления партий
+type lotPart struct {
+	lotID     int64
+	amount    int
+	expiresAt *time.Time
+}
+
+// consumeLots списывает amount из партий пользователя, начиная со старых,
+// и возвращает списанные части. Баллы, начисленные до появления партий,
+// не сгорают и списываются первыми
+func consumeLots(ctx context.Context, tx pgx.Tx, login string, balance int, amount int) ([]lotPart, error) {
+	var tracked int
+	err := tx.QueryRow(ctx, `SELECT COALESCE(SUM(remaining), 0)::bigint FROM accrual_lots WHERE customer = $1`, login).Scan(&tracked)
+	if err != nil {
+		return nil, err
+	}
+	var parts []lotPart
+	if untracked := min(max(balance-tracked, 0), amount); untracked > 0 {
+		parts = append(parts, lotPart{amount: untracked})
+		amount -= untracked
+	}
+	if amount <= 0 {
+		return parts, nil
+	}
+	rows, err := tx.Query(ctx, `SELECT id, remaining, expires_at 
+	FROM accrual_lots 
+	WHERE customer = $1 AND remaining > 0 
+	ORDER BY accrued_at, id 
+	FOR UPDATE`, login)
+	if err != nil {
+		return nil, err
+	}
+	type lot struct {
+		id        int64
+		remaining int
+		expiresAt *time.Time
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining, &l.expiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	remaining := make([]int, len(lots))
+	for i, l := range lots {
+		remaining[i] = l.remaining
+	}
+	for i, take := range takeInOrder(remaining, amount) {
+		if take == 0 {
+			continue
+		}
+		_, err = tx.Exec(ctx, `UPDATE accrual_lots SET remaining = remaining - $1 WHERE id = $2`, take, lots[i].id)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, lotPart{lotID: lots[i].id, amount: take, expiresAt: lots[i].expiresAt})
+	}
+	return parts, nil
+}
+
+// takeInOrder распределяет amount по остаткам available в их порядке и
+// возвращает, сколько взято из каждого. Если остатков не хватает,
+// берется все, что есть
+func takeInOrder(available []int, amount int) []int {
+	taken := make([]int, len(available))
+	for i, left := range available {
+		if amount <= 0 {
+			break
+		}
+		taken[i] = min(left, amount)
+		amount -= taken[i]
+	}
+	return taken
+}
+
+// ExpirePoints списывает с балансов остатки партий с истекшим сроком
+// и записывает их в историю сгораний. Резервы, которые больше не
+// покрыты балансом, закрываются начиная с новых
+func (store SQLStore) ExpirePoints(ctx context.Context) (_ []ExpirationResponse, err error) {
+	defer observe(ctx, "ExpirePoints")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	// пользователи блокируются раньше партий в порядке логинов, как при
+	// списаниях и захвате резервов, иначе сгорание и списание ждут друг друга
+	_, err = tx.Exec(ctx, `SELECT login FROM users 
+	WHERE login IN (SELECT customer FROM accrual_lots WHERE expires_at <= now() AND remaining > 0) 
+	ORDER BY login 
+	FOR UPDATE`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, `SELECT id, customer, order_number, remaining, accrued_at 
+	FROM accrual_lots 
+	WHERE expires_at <= now() AND remaining > 0 
+	ORDER BY id 
+	FOR UPDATE`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var amounts []int
+	var result []ExpirationResponse
+	for rows.Next() {
+		var id int64
+		var number uint64
+		var amount int
+		var accruedAt time.Time
+		var expired ExpirationResponse
+		if err := rows.Scan(&id, &expired.Login, &number, &amount, &accruedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired.OrderNumber = lotOrder(number)
+		expired.Amount = float64(amount) / 100
+		expired.AccruedAt = accruedAt.Format(time.RFC3339)
+		ids = append(ids, id)
+		amounts = append(amounts, amount)
+		result = append(result, expired)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i, expired := range result {
+		_, err = tx.Exec(ctx, `UPDATE accrual_lots SET remaining = 0 WHERE id = $1`, ids[i])
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, `UPDATE users SET accrual_points = accrual_points - $1 WHERE login = $2`, amounts[i], expired.Login)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO point_expirations 
+		(lot_id, customer, amount, expired_at) 
+		VALUES ($1, $2, $3, $4)`, ids[i], expired.Login, amounts[i], now)
+		if err != nil {
+			return nil, err
+		}
+		result[i].ExpiredAt = now.Format(time.RFC3339)
+	}
+	// резервы не должны превышать баланс после сгорания, иначе их
+	// нельзя будет списать
+	expiredFor := make(map[string]bool)
+	for _, expired := range result {
+		if expiredFor[expired.Login] {
+			continue
+		}
+		expiredFor[expired.Login] = true
+		if err = expireExcessHolds(ctx, tx, expired.Login); err != nil {
+			return nil, err
+		}
+	}
+	return result, tx.Commit(ctx)
+}
+
+// GetExpirations возвращает историю сгораний пользователя, от новых к старым
+func (store SQLStore) GetExpirations(ctx context.Context) (_ []ExpirationResponse, err error) {
+	defer observe(ctx, "GetExpirations")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	rows, err := store.DB.Query(ctx, `SELECT l.order_number, e.amount, l.accrued_at, e.expired_at 
+	FROM point_expirations e 
+	JOIN accrual_lots l ON l.id = e.lot_id 
+	WHERE e.customer = $1 
+	ORDER BY e.id DESC`, userLogin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []ExpirationResponse
+	for rows.Next() {
+		var number uint64
+		var amount int
+		var accruedAt, expiredAt time.Time
+		if err := rows.Scan(&number, &amount, &accruedAt, &expiredAt); err != nil {
+			return result, err
+		}
+		result = append(result, ExpirationResponse{
+			Login:       userLogin,
+			OrderNumber: lotOrder(number),
+			Amount:      float64(amount) / 100,
+			AccruedAt:   accruedAt.Format(time.RFC3339),
+			ExpiredAt:   expiredAt.Format(time.RFC3339),
+		})
+	}
+	return result, rows.Err()
+}
+
+// expiringSoon дополняет баланс баллами, сгорающими в ближайшие ExpiringSoonWindow
+func (store SQLStore) expiringSoon(ctx context.Context, login string, balance *BalanceResponce) error {
+	var nearest *time.Time
+	err := store.DB.QueryRow(ctx, `SELECT COALESCE(SUM(remaining), 0)::bigint, MIN(expires_at) 
+	FROM accrual_lots 
+	WHERE customer = $1 AND remaining > 0 AND expires_at <= now() + make_interval(secs => $2)`,
+		login, ExpiringSoonWindow.Seconds()).Scan(&balance.ExpiringSoon, &nearest)
+	if err != nil {
+		return err
+	}
+	if nearest != nil {
+		balance.ExpiringAt = nearest.Format(time.RFC3339)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeInOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		available []int
+		amount    int
+		exp       []int
+	}{
+		{"oldest lot first", []int{300, 500}, 200, []int{200, 0}},
+		{"spills into the next lot", []int{300, 500}, 600, []int{300, 300}},
+		{"exact total", []int{300, 500}, 800, []int{300, 500}},
+		{"not enough", []int{300, 500}, 1000, []int{300, 500}},
+		{"skips empty lots", []int{0, 500}, 100, []int{0, 100}},
+		{"nothing to take", []int{300}, 0, []int{0}},
+		{"no lots", nil, 100, []int{}},
+		{"partial restore keeps the rest withdrawn", []int{150, 400}, 300, []int{150, 150}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.exp, takeInOrder(test.available, test.amount))
+		})
+	}
+}
+
+func TestExpiryRunsAlongsideWithdrawals(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "user", 1100)
+	expired := addTestLot(t, store, "user", 100, 48*time.Hour)
+	addTestLot(t, store, "user", 1000, 24*time.Hour)
+	_, err := store.DB.Exec(context.Background(), `UPDATE accrual_lots SET expires_at = now() - interval '1 hour' WHERE id = $1`, expired)
+	require.NoError(t, err)
+
+	const withdrawals = 10
+	errs := make(chan error, withdrawals+1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := store.ExpirePoints(context.Background())
+		errs <- err
+	}()
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.WithdrawFromUser(userContext("user"), WithdrawRequest{OrderNumber: "2377225624", Amount: 0.5})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	_, err = store.ExpirePoints(context.Background())
+	require.NoError(t, err)
+	var tracked int
+	err = store.DB.QueryRow(context.Background(), `SELECT SUM(remaining)::bigint FROM accrual_lots WHERE customer = 'user'`).Scan(&tracked)
+	require.NoError(t, err)
+	assert.Equal(t, tracked, userBalance(t, store, "user"), "the balance matches the lots")
+}
@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/jackc/pgx/v5"
+)
+
+// Состояния резерва баллов
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+	HoldExpired  = "EXPIRED"
+)
+
+var (
+	ErrHoldNotFound  = errors.New("hold not found")
+	ErrHoldNotActive = errors.New("hold is not active")
+	ErrHoldExpired   = errors.New("hold has expired")
+	ErrHoldExists    = errors.New("order already has an active hold")
+)
+
+// HoldTTL - сколько действует резерв, задается конфигурацией (hold_ttl)
+var HoldTTL = 15 * time.Minute
+
+// HoldRequest - резерв баллов под списание в счет заказа
+type HoldRequest struct {
+	OrderNumber string  `json:"order"`
+	Amount      float64 `json:"sum"`
+}
+
+type HoldResponse struct {
+	ID          int64   `json:"id"`
+	Login       string  `json:"-"`
+	OrderNumber string  `json:"order"`
+	Amount      float64 `json:"sum"`
+	State       string  `json:"status"`
+	CreatedAt   string  `json:"created_at"`
+	ExpiresAt   string  `json:"expires_at"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+}
+
+type holdRow struct {
+	id          int64
+	customer    string
+	orderNumber uint64
+	amount      int
+	state       string
+	createdAt   time.Time
+	expiresAt   time.Time
+	completedAt *time.Time
+}
+
+const holdColumns = `id, customer, order_number, amount, state, created_at, expires_at, completed_at`
+
+func (h *holdRow) scan(row pgx.Row) error {
+	return row.Scan(&h.id, &h.customer, &h.orderNumber, &h.amount, &h.state, &h.createdAt, &h.expiresAt, &h.completedAt)
+}
+
+func (h holdRow) response() HoldResponse {
+	result := HoldResponse{
+		ID:          h.id,
+		Login:       h.customer,
+		OrderNumber: strconv.FormatUint(h.orderNumber, 10),
+		Amount:      float64(h.amount) / 100,
+		State:       h.state,
+		CreatedAt:   h.createdAt.Format(time.RFC3339),
+		ExpiresAt:   h.expiresAt.Format(time.RFC3339),
+	}
+	if h.completedAt != nil {
+		result.CompletedAt = h.completedAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// rowQuerier - *pgxpool.Pool или pgx.Tx
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// heldPoints - сумма действующих резервов пользователя в копейках
+func heldPoints(ctx context.Context, q rowQuerier, login string) (int, error) {
+	var held int
+	err := q.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0)::bigint
+	FROM point_holds
+	WHERE customer = $1 AND state = 'ACTIVE' AND expires_at > now()`, login).Scan(&held)
+	return held, err
+}
+
+// excessHolds - сколько резервов из amounts (от новых к старым) нужно
+// закрыть, чтобы оставшиеся уложились в баланс
+func excessHolds(balance int, amounts []int) int {
+	held := 0
+	for _, amount := range amounts {
+		held += amount
+	}
+	n := 0
+	for n < len(amounts) && held > balance {
+		held -= amounts[n]
+		n++
+	}
+	return n
+}
+
+// expireExcessHolds закрывает самые новые резервы пользователя, которые
+// больше не покрыты балансом, например после сгорания баллов. Вызывается
+// после изменения баланса в той же транзакции
+func expireExcessHolds(ctx context.Context, tx pgx.Tx, login string) error {
+	var balance int
+	err := tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1 FOR UPDATE`, login).Scan(&balance)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, `SELECT id, amount
+	FROM point_holds
+	WHERE customer = $1 AND state = 'ACTIVE' AND expires_at > now()
+	ORDER BY created_at DESC, id DESC
+	FOR UPDATE`, login)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	var amounts []int
+	for rows.Next() {
+		var id int64
+		var amount int
+		if err := rows.Scan(&id, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+		amounts = append(amounts, amount)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	n := excessHolds(balance, amounts)
+	if n == 0 {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `UPDATE point_holds SET state = $1, completed_at = now() WHERE id = ANY($2)`, HoldExpired, ids[:n])
+	return err
+}
+
+// CreateHold резервирует баллы на HoldTTL. Зарезервированные баллы
+// остаются на балансе, но недоступны для списаний и переводов
+func (store SQLStore) CreateHold(ctx context.Context, hold HoldRequest) (_ HoldResponse, err error) {
+	defer observe(ctx, "CreateHold")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return HoldResponse{}, ErrNoLogin
+	}
+	orderNumber, err := strconv.ParseUint(hold.OrderNumber, 10, 64)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	amount := Cents(hold.Amount)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	var balance int
+	err = tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1 FOR UPDATE`, userLogin).Scan(&balance)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	held, err := heldPoints(ctx, tx, userLogin)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	if balance-held < amount {
+		return HoldResponse{}, ErrInsufficientFunds
+	}
+	// просроченный резерв заказа, который еще не закрыл ReleaseExpiredHolds,
+	// не мешает новому
+	_, err = tx.Exec(ctx, `UPDATE point_holds SET state = $1, completed_at = now()
+	WHERE order_number = $2 AND state = 'ACTIVE' AND expires_at <= now()`, HoldExpired, orderNumber)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	row := holdRow{customer: userLogin, orderNumber: orderNumber, amount: amount, state: HoldActive}
+	err = tx.QueryRow(ctx, `INSERT INTO point_holds (customer, order_number, amount, state, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, now(), now() + make_interval(secs => $5))
+	RETURNING id, created_at, expires_at`,
+		row.customer, row.orderNumber, row.amount, row.state, HoldTTL.Seconds()).Scan(&row.id, &row.createdAt, &row.expiresAt)
+	if isUniqueViolation(err) {
+		return HoldResponse{}, ErrHoldExists
+	}
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	return row.response(), tx.Commit(ctx)
+}
+
+// CaptureHold списывает зарезервированные баллы в счет заказа резерва,
+// как WithdrawFromUser, и закрывает резерв
+func (store SQLStore) CaptureHold(ctx context.Context, id int64) (_ WithdrawResponse, err error) {
+	defer observe(ctx, "CaptureHold")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	row, balance, err := lockActiveHold(ctx, tx, id)
+	if errors.Is(err, ErrHoldExpired) {
+		return WithdrawResponse{}, expireHold(ctx, tx, id)
+	}
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	// баллы могли сгореть или быть отменены возвратом после резерва
+	if balance < row.amount {
+		return WithdrawResponse{}, ErrInsufficientFunds
+	}
+	orderNumber := strconv.FormatUint(row.orderNumber, 10)
+	now := time.Now()
+	if err = debitPoints(ctx, tx, row.customer, balance, orderNumber, row.amount, now); err != nil {
+		return WithdrawResponse{}, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE point_holds SET state = $1, completed_at = $2 WHERE id = $3`, HoldCaptured, now, id)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return WithdrawResponse{}, err
+	}
+	metrics.PointsWithdrawn.Add(float64(row.amount) / 100)
+	return WithdrawResponse{
+		Login:       row.customer,
+		OrderNumber: orderNumber,
+		Amount:      float64(row.amount) / 100,
+		ProcessedAt: now.Format(time.RFC3339),
+		Status:      WithdrawalProcessed,
+	}, nil
+}
+
+// ReleaseHold снимает резерв, баллы снова доступны
+func (store SQLStore) ReleaseHold(ctx context.Context, id int64) (_ HoldResponse, err error) {
+	defer observe(ctx, "ReleaseHold")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	row, _, err := lockActiveHold(ctx, tx, id)
+	if errors.Is(err, ErrHoldExpired) {
+		return HoldResponse{}, expireHold(ctx, tx, id)
+	}
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, `UPDATE point_holds SET state = $1, completed_at = $2 WHERE id = $3`, HoldReleased, now, id)
+	if err != nil {
+		return HoldResponse{}, err
+	}
+	row.state = HoldReleased
+	row.completedAt = &now
+	return row.response(), tx.Commit(ctx)
+}
+
+// ReleaseExpiredHolds закрывает резервы с истекшим сроком
+func (store SQLStore) ReleaseExpiredHolds(ctx context.Context) (_ []HoldResponse, err error) {
+	defer observe(ctx, "ReleaseExpiredHolds")(&err)
+	rows, err := store.DB.Query(ctx, `UPDATE point_holds
+	SET state = 'EXPIRED', completed_at = now()
+	WHERE state = 'ACTIVE' AND expires_at <= now()
+	RETURNING `+holdColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []HoldResponse
+	for rows.Next() {
+		var row holdRow
+		if err := row.scan(rows); err != nil {
+			return result, err
+		}
+		result = append(result, row.response())
+	}
+	return result, rows.Err()
+}
+
+// lockActiveHold блокирует строку текущего пользователя, затем его
+// действующий резерв, и возвращает резерв и баланс пользователя. Порядок
+// блокировок тот же, что у expireExcessHolds: сначала пользователь, потом
+// резервы. Для просроченного резерва возвращает ErrHoldExpired, закрыть
+// его должен вызывающий через expireHold
+func lockActiveHold(ctx context.Context, tx pgx.Tx, id int64) (holdRow, int, error) {
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return holdRow{}, 0, ErrNoLogin
+	}
+	var balance int
+	err := tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1 FOR UPDATE`, userLogin).Scan(&balance)
+	if err != nil {
+		return holdRow{}, 0, err
+	}
+	var row holdRow
+	err = row.scan(tx.QueryRow(ctx, `SELECT `+holdColumns+`
+	FROM point_holds
+	WHERE id = $1 AND customer = $2
+	FOR UPDATE`, id, userLogin))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return holdRow{}, 0, ErrHoldNotFound
+	}
+	if err != nil {
+		return holdRow{}, 0, err
+	}
+	if row.state != HoldActive {
+		return row, balance, ErrHoldNotActive
+	}
+	if !time.Now().Before(row.expiresAt) {
+		return row, balance, ErrHoldExpired
+	}
+	return row, balance, nil
+}
+
+// expireHold закрывает просроченный резерв сразу, не дожидаясь
+// ReleaseExpiredHolds, фиксирует транзакцию и возвращает ErrHoldExpired
+func expireHold(ctx context.Context, tx pgx.Tx, id int64) error {
+	_, err := tx.Exec(ctx, `UPDATE point_holds SET state = $1, completed_at = now() WHERE id = $2`, HoldExpired, id)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	return ErrHoldExpired
+}
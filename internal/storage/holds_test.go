@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcessHolds(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int
+		amounts []int
+		exp     int
+	}{
+		{"no holds", 100, nil, 0},
+		{"covered", 500, []int{200, 300}, 0},
+		{"newest first", 400, []int{200, 300}, 1},
+		{"all uncovered", 0, []int{200, 300}, 2},
+		{"drops until covered", 300, []int{100, 100, 300}, 2},
+		{"negative balance", -10, []int{100}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.exp, excessHolds(test.balance, test.amounts))
+		})
+	}
+}
+
+func TestCaptureRunsAlongsideExpiry(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "user", 1100)
+	expired := addTestLot(t, store, "user", 100, 48*time.Hour)
+	addTestLot(t, store, "user", 1000, 24*time.Hour)
+	_, err := store.DB.Exec(context.Background(), `UPDATE accrual_lots SET expires_at = now() - interval '1 hour' WHERE id = $1`, expired)
+	require.NoError(t, err)
+	var holds []int64
+	for _, order := range []string{"12345678903", "2377225624", "9278923470"} {
+		hold, err := store.CreateHold(userContext("user"), HoldRequest{OrderNumber: order, Amount: 1})
+		require.NoError(t, err)
+		holds = append(holds, hold.ID)
+	}
+
+	errs := make(chan error, len(holds)+1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := store.ExpirePoints(context.Background())
+		errs <- err
+	}()
+	for _, id := range holds {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			_, err := store.CaptureHold(userContext("user"), id)
+			errs <- err
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	var tracked int
+	err = store.DB.QueryRow(context.Background(), `SELECT SUM(remaining)::bigint FROM accrual_lots WHERE customer = 'user'`).Scan(&tracked)
+	require.NoError(t, err)
+	assert.Equal(t, tracked, userBalance(t, store, "user"), "the balance matches the lots")
+	assert.LessOrEqual(t, userBalance(t, store, "user"), 800, "all three holds are captured")
+}
+
+func TestOneActiveHoldPerOrder(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "user", 1000)
+	first, err := store.CreateHold(userContext("user"), HoldRequest{OrderNumber: "2377225624", Amount: 1})
+	require.NoError(t, err)
+
+	_, err = store.CreateHold(userContext("user"), HoldRequest{OrderNumber: "2377225624", Amount: 1})
+	require.ErrorIs(t, err, ErrHoldExists)
+
+	_, err = store.DB.Exec(context.Background(), `UPDATE point_holds SET expires_at = now() - interval '1 minute' WHERE id = $1`, first.ID)
+	require.NoError(t, err)
+	_, err = store.CreateHold(userContext("user"), HoldRequest{OrderNumber: "2377225624", Amount: 1})
+	require.NoError(t, err, "an expired hold does not block a new one")
+}
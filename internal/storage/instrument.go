@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Azcarot/GopherMarketProject/internal/storage")
+
+// slowCallThreshold - вызовы дольше этого попадают в лог запроса
+const slowCallThreshold = 500 * time.Millisecond
+
+// observe открывает спан и замеряет длительность вызова метода хранилища.
+// Ошибка берется из именованного результата метода и отмечается в спане,
+// pgx.ErrNoRows ошибкой не считается:
+// defer observe(ctx, "GetUserBalance")(&err)
+func observe(ctx context.Context, method string) func(err *error) {
+	start := time.Now()
+	_, span := tracer.Start(ctx, "storage."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql"), attribute.String("db.operation", method)))
+	return func(err *error) {
+		duration := time.Since(start)
+		metrics.DBQueryDuration.WithLabelValues(method).Observe(duration.Seconds())
+		if duration > slowCallThreshold {
+			logger.FromContext(ctx).Warnw("slow storage call", "method", method, "duration", duration)
+		}
+		if *err != nil && !errors.Is(*err, pgx.ErrNoRows) {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
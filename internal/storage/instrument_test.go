@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserveRecordsErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	tests := []struct {
+		name   string
+		err    error
+		status codes.Code
+		events int
+	}{
+		{name: "success", err: nil, status: codes.Unset, events: 0},
+		{name: "no rows", err: pgx.ErrNoRows, status: codes.Unset, events: 0},
+		{name: "failure", err: errors.New("connection refused"), status: codes.Error, events: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			func() (err error) {
+				defer observe(context.Background(), "Test")(&err)
+				return tt.err
+			}()
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			require.Equal(t, "storage.Test", span.Name())
+			require.Equal(t, tt.status, span.Status().Code)
+			require.Len(t, span.Events(), tt.events, "the error must be recorded as a span event")
+		})
+	}
+}
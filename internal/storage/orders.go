@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/jackc/pgx/v5"
 )
 
-func (store SQLStore) CreateNewOrder(ctx context.Context, data OrderData) error {
+func (store SQLStore) CreateNewOrder(ctx context.Context, data OrderData) (err error) {
+	defer observe(ctx, "CreateNewOrder")(&err)
 	data.State = "NEW"
 	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
 	if !ok {
@@ -18,10 +20,14 @@ func (store SQLStore) CreateNewOrder(ctx context.Context, data OrderData) error
 	if err != nil {
 		return err
 	}
-	_, err = store.DB.Exec(ctx, `INSERT INTO orders 
+	_, err = tx.Exec(ctx, `INSERT INTO orders 
 	(order_number, accrual_points, state, customer, withdrawal, created) 
 	values ($1, $2, $3, $4, $5, $6);`,
 		data.OrderNumber, data.Accrual, data.State, dataLogin, data.Withdrawal, data.Date)
+	if isUniqueViolation(err) {
+		tx.Rollback(ctx)
+		return ErrOrderExists
+	}
 	if err != nil {
 		tx.Rollback(ctx)
 		return err
@@ -34,46 +40,42 @@ func (store SQLStore) CreateNewOrder(ctx context.Context, data OrderData) error
 	return nil
 }
 
-func (store SQLStore) GetCustomerOrders(ctx context.Context) ([]OrderResponse, error) {
+func (store SQLStore) GetCustomerOrders(ctx context.Context) (_ []OrderResponse, err error) {
+	defer observe(ctx, "GetCustomerOrders")(&err)
 	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
 
 	if !ok {
 		return nil, ErrNoLogin
 	}
 	result := []OrderResponse{}
-	for {
-		select {
-		case <-ctx.Done():
-			return result, errTimeout
-		default:
-			query := fmt.Sprintf(`SELECT order_number, accrual_points, state, created 
+	query := fmt.Sprintf(`SELECT order_number, accrual_points, state, created, reversed 
 	FROM orders 
 	WHERE customer = '%s' 
 	ORDER BY id DESC`, dataLogin)
 
-			rows, err := store.DB.Query(ctx, query)
-			if err != nil {
-				return nil, err
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var order OrderResponse
-				if err := rows.Scan(&order.OrderNumber, &order.Accrual, &order.State, &order.Date); err != nil {
-					return result, err
-				}
-				order.Accrual = order.Accrual / 100
-				result = append(result, order)
-			}
-			if err = rows.Err(); err != nil {
-				return result, err
-			}
-			return result, nil
+	rows, err := store.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var order OrderResponse
+		if err := rows.Scan(&order.OrderNumber, &order.Accrual, &order.State, &order.Date, &order.Reversed); err != nil {
+			return result, err
 		}
+		order.Accrual = order.Accrual / 100
+		order.Reversed = order.Reversed / 100
+		result = append(result, order)
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
 	}
+	return result, nil
 
 }
 
-func (store SQLStore) CheckIfOrderExists(ctx context.Context, data OrderData) (bool, bool, error) {
+func (store SQLStore) CheckIfOrderExists(ctx context.Context, data OrderData) (_, _ bool, err error) {
+	defer observe(ctx, "CheckIfOrderExists")(&err)
 	var query string
 	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
 	if !ok {
@@ -84,7 +86,7 @@ func (store SQLStore) CheckIfOrderExists(ctx context.Context, data OrderData) (b
 	WHERE order_number = %d`, data.OrderNumber)
 	var number uint64
 	var login string
-	err := store.DB.QueryRow(ctx, query).Scan(&number, &login)
+	err = store.DB.QueryRow(ctx, query).Scan(&number, &login)
 	if errors.Is(err, pgx.ErrNoRows) {
 		//No order
 		return true, false, err
@@ -97,18 +99,19 @@ func (store SQLStore) CheckIfOrderExists(ctx context.Context, data OrderData) (b
 	return false, false, err
 }
 
-func (store SQLStore) GetUnfinishedOrders() ([]uint64, error) {
-	sqlQuery := "SELECT order_number FROM orders WHERE state IN ('NEW', 'PROCESSING')"
+func (store SQLStore) GetUnfinishedOrders() (_ []OrderData, err error) {
+	defer observe(context.Background(), "GetUnfinishedOrders")(&err)
+	sqlQuery := "SELECT order_number, customer FROM orders WHERE state IN ('NEW', 'PROCESSING')"
 	ctx := context.Background()
-	var result []uint64
+	var result []OrderData
 	rows, err := store.DB.Query(ctx, sqlQuery)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var order uint64
-		if err := rows.Scan(&order); err != nil {
+		var order OrderData
+		if err := rows.Scan(&order.OrderNumber, &order.User); err != nil {
 			return result, err
 		}
 		result = append(result, order)
@@ -120,34 +123,133 @@ func (store SQLStore) GetUnfinishedOrders() ([]uint64, error) {
 
 }
 
-func (store SQLStore) UpdateOrder(ctx context.Context, data OrderData) error {
+func (store SQLStore) UpdateOrder(ctx context.Context, data OrderData) (err error) {
+	defer observe(ctx, "UpdateOrder")(&err)
 	sql := `
 	UPDATE orders 
 	SET accrual_points = $1, state = $2 
 	WHERE order_number = $3;
 `
-	for {
-		select {
-		case <-ctx.Done():
-			return errTimeout
-		default:
-			tx, err := store.DB.Begin(ctx)
-			if err != nil {
-				return err
-			}
-
-			_, err = store.DB.Exec(ctx, sql, data.Accrual, data.State, data.OrderNumber)
-			if err != nil {
-				tx.Rollback(ctx)
-				return err
-			}
-			err = tx.Commit(ctx)
-			if err != nil {
-				tx.Rollback(ctx)
-				return err
-			}
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, sql, data.Accrual, data.State, data.OrderNumber)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	if event, ok := orderStateWebhooks[data.State]; ok {
+		var login string
+		err = tx.QueryRow(ctx, `SELECT customer FROM orders WHERE order_number = $1`, data.OrderNumber).Scan(&login)
+		if err != nil {
+			tx.Rollback(ctx)
 			return err
 		}
+		err = enqueueWebhook(ctx, tx, login, WebhookPayload{
+			Event:       event,
+			OrderNumber: strconv.FormatUint(data.OrderNumber, 10),
+			Status:      data.State,
+			Accrual:     float64(data.Accrual) / 100,
+		})
+		if err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	return err
+
+}
+
+// Результаты пакетной загрузки заказов
+const (
+	BatchAccepted      = "accepted"
+	BatchDuplicateOwn  = "duplicate-own"
+	BatchConflict      = "conflict-other-user"
+	BatchInvalidLuhn   = "invalid-luhn"
+	BatchInvalidFormat = "invalid-format"
+)
+
+// batchAttempts - сколько раз загрузка пакета повторяется, если
+// параллельный запрос успел загрузить те же номера
+const batchAttempts = 3
+
+// CreateOrdersBatch загружает заказы одной транзакцией через COPY
+// и возвращает результат для каждого заказа в порядке входного списка
+func (store SQLStore) CreateOrdersBatch(ctx context.Context, orders []OrderData) (_ []string, err error) {
+	defer observe(ctx, "CreateOrdersBatch")(&err)
+	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	var result []string
+	for attempt := 0; attempt < batchAttempts; attempt++ {
+		result, err = store.copyOrdersBatch(ctx, dataLogin, orders)
+		if !isUniqueViolation(err) {
+			break
+		}
 	}
+	return result, err
+}
 
+func (store SQLStore) copyOrdersBatch(ctx context.Context, dataLogin string, orders []OrderData) ([]string, error) {
+	numbers := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		numbers = append(numbers, int64(order.OrderNumber))
+	}
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, `SELECT order_number, customer 
+	FROM orders 
+	WHERE order_number = ANY($1)`, numbers)
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[uint64]string)
+	for rows.Next() {
+		var number uint64
+		var login string
+		if err := rows.Scan(&number, &login); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owners[number] = login
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]string, len(orders))
+	var newRows [][]any
+	for i, order := range orders {
+		owner, exists := owners[order.OrderNumber]
+		switch {
+		case !exists:
+			result[i] = BatchAccepted
+			owners[order.OrderNumber] = dataLogin
+			newRows = append(newRows, []any{int64(order.OrderNumber), 0, "NEW", dataLogin, 0, order.Date})
+		case owner == dataLogin:
+			result[i] = BatchDuplicateOwn
+		default:
+			result[i] = BatchConflict
+		}
+	}
+	if len(newRows) > 0 {
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"orders"},
+			[]string{"order_number", "accrual_points", "state", "customer", "withdrawal", "created"},
+			pgx.CopyFromRows(newRows))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, tx.Commit(ctx)
 }
@@ -4,19 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
 	"github.com/golang-jwt/jwt"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const SecretKey string = "super-secret"
 
+// JWTSecret - ключ подписи токенов, задается конфигурацией (jwt_secret).
+// Пароли по-прежнему хешируются с SecretKey
+var JWTSecret = SecretKey
+
 type MyCustomClaims struct {
 	jwt.MapClaims
 }
@@ -28,6 +33,7 @@ var mut sync.Mutex
 const UserLoginCtxKey CtxKey = "userLogin"
 const OrderNumberCtxKey CtxKey = "orderNumber"
 const DBCtxKey CtxKey = "dbConn"
+const RequestIDCtxKey CtxKey = "requestID"
 
 type UserData struct {
 	Login         string
@@ -50,11 +56,25 @@ type OrderResponse struct {
 	Accrual     float64 `json:"accrual"`
 	State       string  `json:"status"`
 	Date        string  `json:"uploaded_at"`
+	// сколько начисления отменено возвратом
+	Reversed float64 `json:"reversed,omitempty"`
 }
 
 type BalanceResponce struct {
 	Accrual   float64 `json:"current"`
 	Withdrawn float64 `json:"withdrawn"`
+	// из current: зарезервировано под списания и доступно
+	Held      float64 `json:"held"`
+	Available float64 `json:"available"`
+	// баллы, которые сгорят в ближайшие ExpiringSoonWindow,
+	// и дата ближайшего сгорания
+	ExpiringSoon float64 `json:"expiring_soon"`
+	ExpiringAt   string  `json:"expiring_at,omitempty"`
+	// уровень программы лояльности
+	Tier TierInfo `json:"tier"`
+	// долг после отмены начисления по уже потраченным баллам,
+	// гасится из следующих начислений
+	Debt float64 `json:"debt,omitempty"`
 }
 
 type PgxStorage interface {
@@ -65,22 +85,63 @@ type PgxStorage interface {
 	CreateNewOrder(ctx context.Context, data OrderData) error
 	UpdateOrder(ctx context.Context, orderData OrderData) error
 	AddBalanceToUser(orderData OrderData) (bool, error)
-	WithdrawFromUser(ctx context.Context, withdraw WithdrawRequest) error
+	WithdrawFromUser(ctx context.Context, withdraw WithdrawRequest) (WithdrawResponse, error)
 	GetUserBalance(ctx context.Context, data UserData) (BalanceResponce, error)
 	GetWithdrawals(ctx context.Context) ([]WithdrawResponse, error)
 	GetCustomerOrders(ctx context.Context) ([]OrderResponse, error)
 	CheckIfOrderExists(ctx context.Context, data OrderData) (bool, bool, error)
-	GetUnfinishedOrders() ([]uint64, error)
+	GetUnfinishedOrders() ([]OrderData, error)
+	CreateOrdersBatch(ctx context.Context, orders []OrderData) ([]string, error)
+	CreateWebhook(ctx context.Context, data WebhookData) (WebhookData, error)
+	GetWebhooks(ctx context.Context) ([]WebhookData, error)
+	DeleteWebhook(ctx context.Context, id int64) (bool, error)
+	GetPendingDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
+	ExpirePoints(ctx context.Context) ([]ExpirationResponse, error)
+	GetExpirations(ctx context.Context) ([]ExpirationResponse, error)
+	RecalculateTiers(ctx context.Context) ([]TierChange, error)
+	GetTierHistory(ctx context.Context) ([]TierChange, error)
+	CreateTransfer(ctx context.Context, transfer TransferRequest) (TransferResponse, error)
+	ConfirmTransfer(ctx context.Context, id int64) (TransferResponse, error)
+	GetTransfers(ctx context.Context) ([]TransferResponse, error)
+	ReverseWithdrawal(ctx context.Context, reversal WithdrawalReversal) (WithdrawResponse, error)
+	GetAuditLog(ctx context.Context, limit int) ([]AuditEntry, error)
+	ReverseAccrual(ctx context.Context, reversal AccrualReversal) (AccrualReversalResponse, error)
+	GetRecentProcessedOrders(ctx context.Context, window time.Duration) ([]OrderData, error)
+	CreateHold(ctx context.Context, hold HoldRequest) (HoldResponse, error)
+	CaptureHold(ctx context.Context, id int64) (WithdrawResponse, error)
+	ReleaseHold(ctx context.Context, id int64) (HoldResponse, error)
+	ReleaseExpiredHolds(ctx context.Context) ([]HoldResponse, error)
+	GetTransactions(ctx context.Context, after TxCursor, limit int) ([]Transaction, error)
 }
 
+// SQLStore работает через пул соединений: *pgx.Conn нельзя использовать
+// из нескольких горутин. Все запросы одной операции идут через ее транзакцию
 type SQLStore struct {
-	DB *pgx.Conn
+	DB *pgxpool.Pool
 }
 
-var DB *pgx.Conn
+var DB *pgxpool.Pool
 var ST PgxStorage
-var errTimeout = fmt.Errorf("timeout exceeded")
 var ErrNoLogin = fmt.Errorf("no login in context")
+var ErrInsufficientFunds = fmt.Errorf("payment required")
+
+// ErrOrderExists - заказ с таким номером загружен параллельным запросом
+var ErrOrderExists = errors.New("order already exists")
+
+// Cents переводит сумму в баллах в копейки, в которых баллы хранятся в
+// базе. Суммы меньше половины копейки становятся нулем
+func Cents(points float64) int {
+	return int(math.Round(points * 100))
+}
+
+// uniqueViolation - код ошибки Postgres при нарушении уникального индекса
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
 
 type pgxConnTime struct {
 	attempts          int
@@ -93,12 +154,16 @@ type WithdrawRequest struct {
 }
 
 type WithdrawResponse struct {
+	Login       string  `json:"-"`
 	OrderNumber string  `json:"order"`
 	Amount      float64 `json:"sum"`
 	ProcessedAt string  `json:"processed_at"`
+	// PROCESSED или REVERSED, если списание отменено
+	Status     string `json:"status,omitempty"`
+	ReversedAt string `json:"reversed_at,omitempty"`
 }
 
-func MakeStore(db *pgx.Conn) PgxStorage {
+func MakeStore(db *pgxpool.Pool) PgxStorage {
 	return &SQLStore{
 		DB: db,
 	}
@@ -133,63 +198,203 @@ func NewConn(f utils.Flags) error {
 func connectToDB(f utils.Flags) error {
 	var err error
 	ps := fmt.Sprintf(f.FlagDBAddr)
-	DB, err = pgx.Connect(context.Background(), ps)
+	DB, err = pgxpool.New(context.Background(), ps)
+	if err != nil {
+		return err
+	}
 	ST = MakeStore(DB)
-	return err
+	// пул подключается лениво, проверяем доступность базы сразу
+	return DB.Ping(context.Background())
 }
 
-func CheckDBConnection() http.Handler {
-	checkConnection := func(res http.ResponseWriter, req *http.Request) {
+var errNoConnection = errors.New("no database connection")
+var errNoMigrations = errors.New("tables have not been created")
 
-		err := DB.Ping(context.Background())
-		result := (err == nil)
-		if result {
-			res.WriteHeader(http.StatusOK)
-		} else {
-			res.WriteHeader(http.StatusInternalServerError)
-		}
+// migrated выставляется, когда все таблицы созданы без ошибок
+var migrated atomic.Bool
 
+// Ping проверяет доступность базы, используется проверкой готовности.
+// Проверка берет свое соединение из пула и не мешает запросам обработчиков
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errNoConnection
 	}
-	return http.HandlerFunc(checkConnection)
+	return DB.Ping(ctx)
 }
 
-func (store SQLStore) CreateTablesForGopherStore() {
-	ctx := context.Background()
-	mut.Lock()
-	defer mut.Unlock()
-	queryForFun := `DROP TABLE IF EXISTS users CASCADE`
-	store.DB.Exec(ctx, queryForFun)
-	query := `CREATE TABLE IF NOT EXISTS users (
+// CheckMigrations сообщает, созданы ли таблицы сервиса
+func CheckMigrations(ctx context.Context) error {
+	if !migrated.Load() {
+		return errNoMigrations
+	}
+	return nil
+}
+
+// gopherTables - таблицы сервиса в порядке создания
+var gopherTables = []struct {
+	name  string
+	query string
+}{
+	{"users", `CREATE TABLE IF NOT EXISTS users (
 		id SERIAL NOT NULL PRIMARY KEY, 
 		login text NOT NULL, 
 		password text NOT NULL, 
 		accrual_points bigint NOT NULL, 
 		withdrawal BIGINT NOT NULL,
-		created text )`
-
-	_, err := store.DB.Exec(ctx, query)
-
-	if err != nil {
-
-		log.Printf("Error %s when creating user table", err)
-
-	}
-	queryForFun = `DROP TABLE IF EXISTS orders CASCADE`
-	store.DB.Exec(ctx, queryForFun)
-	query = `CREATE TABLE IF NOT EXISTS orders(
+		created text,
+		tier TEXT,
+		debt BIGINT NOT NULL DEFAULT 0 )`},
+	{"orders", `CREATE TABLE IF NOT EXISTS orders(
 		id SERIAL NOT NULL PRIMARY KEY,
 		order_number BIGINT,
 		accrual_points BIGINT NOT NULL,
 		state TEXT,
 		withdrawal BIGINT NOT NULL,
 		customer TEXT NOT NULL,
+		created TEXT,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		reversed BIGINT NOT NULL DEFAULT 0
+	)`},
+	{"accrual_lots", `CREATE TABLE IF NOT EXISTS accrual_lots(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		order_number BIGINT NOT NULL,
+		amount BIGINT NOT NULL,
+		base_amount BIGINT NOT NULL,
+		remaining BIGINT NOT NULL,
+		accrued_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ
+	)`},
+	{"point_expirations", `CREATE TABLE IF NOT EXISTS point_expirations(
+		id SERIAL NOT NULL PRIMARY KEY,
+		lot_id INTEGER NOT NULL,
+		customer TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		expired_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"tier_history", `CREATE TABLE IF NOT EXISTS tier_history(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		from_tier TEXT NOT NULL,
+		to_tier TEXT NOT NULL,
+		direction TEXT NOT NULL,
+		accrued BIGINT NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"transfers", `CREATE TABLE IF NOT EXISTS transfers(
+		id SERIAL NOT NULL PRIMARY KEY,
+		sender TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		state TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		completed_at TIMESTAMPTZ
+	)`},
+	{"point_holds", `CREATE TABLE IF NOT EXISTS point_holds(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		order_number BIGINT NOT NULL,
+		amount BIGINT NOT NULL,
+		state TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		completed_at TIMESTAMPTZ
+	)`},
+	{"withdrawal_lots", `CREATE TABLE IF NOT EXISTS withdrawal_lots(
+		id SERIAL NOT NULL PRIMARY KEY,
+		withdrawal_id INTEGER NOT NULL,
+		lot_id INTEGER NOT NULL,
+		amount BIGINT NOT NULL
+	)`},
+	{"withdrawal_reversals", `CREATE TABLE IF NOT EXISTS withdrawal_reversals(
+		id SERIAL NOT NULL PRIMARY KEY,
+		withdrawal_id INTEGER NOT NULL UNIQUE,
+		customer TEXT NOT NULL,
+		order_number BIGINT NOT NULL,
+		amount BIGINT NOT NULL,
+		actor TEXT NOT NULL,
+		role TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"accrual_reversals", `CREATE TABLE IF NOT EXISTS accrual_reversals(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		order_number BIGINT NOT NULL,
+		amount BIGINT NOT NULL,
+		debited BIGINT NOT NULL,
+		debt BIGINT NOT NULL,
+		actor TEXT NOT NULL,
+		role TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"balance_adjustments", `CREATE TABLE IF NOT EXISTS balance_adjustments(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		order_number BIGINT NOT NULL,
+		amount BIGINT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"audit_log", `CREATE TABLE IF NOT EXISTS audit_log(
+		id SERIAL NOT NULL PRIMARY KEY,
+		actor TEXT NOT NULL,
+		role TEXT NOT NULL,
+		action TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		object TEXT NOT NULL,
+		details TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`},
+	{"webhooks", `CREATE TABLE IF NOT EXISTS webhooks(
+		id SERIAL NOT NULL PRIMARY KEY,
+		customer TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
 		created TEXT
-	)`
-	_, err = store.DB.Exec(ctx, query)
-
-	if err != nil {
+	)`},
+	{"webhook_outbox", `CREATE TABLE IF NOT EXISTS webhook_outbox(
+		id SERIAL NOT NULL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		next_attempt TIMESTAMPTZ NOT NULL,
+		last_error TEXT,
+		created TEXT
+	)`},
+}
 
-		log.Printf("Error %s when creating order table", err)
+// gopherIndexes создаются после всех таблиц
+var gopherIndexes = []string{
+	// номер заказа начисления уникален; списания могут ссылаться на любые номера
+	`CREATE UNIQUE INDEX IF NOT EXISTS orders_accrual_number ON orders (order_number) WHERE withdrawal = 0`,
+	// у заказа не больше одного действующего резерва
+	`CREATE UNIQUE INDEX IF NOT EXISTS point_holds_active_order ON point_holds (order_number) WHERE state = 'ACTIVE'`,
+}
 
+func (store SQLStore) CreateTablesForGopherStore() {
+	ctx := context.Background()
+	mut.Lock()
+	defer mut.Unlock()
+	ok := true
+	for _, table := range gopherTables {
+		queryForFun := fmt.Sprintf(`DROP TABLE IF EXISTS %s CASCADE`, table.name)
+		store.DB.Exec(ctx, queryForFun)
+		_, err := store.DB.Exec(ctx, table.query)
+
+		if err != nil {
+			logger.Default().Errorw("failed to create table", "table", table.name, "error", err)
+			ok = false
+		}
+	}
+	for _, index := range gopherIndexes {
+		if _, err := store.DB.Exec(ctx, index); err != nil {
+			logger.Default().Errorw("failed to create index", "query", index, "error", err)
+			ok = false
+		}
 	}
+	migrated.Store(ok)
 }
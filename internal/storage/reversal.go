@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Состояния списания в GET /api/user/withdrawals
+const (
+	WithdrawalProcessed = "PROCESSED"
+	WithdrawalReversed  = "REVERSED"
+)
+
+var (
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+	ErrAlreadyReversed    = errors.New("withdrawal is already reversed")
+	ErrCancelWindowClosed = errors.New("withdrawal can no longer be cancelled")
+)
+
+// WithdrawalReversal - запрос на отмену списания
+type WithdrawalReversal struct {
+	OrderNumber uint64
+	// владелец списания; пустой - любой пользователь (администратор, партнер)
+	Customer string
+	Actor    string
+	Role     string
+	Reason   string
+	// сколько после списания его можно отменить, 0 - без ограничения
+	Window time.Duration
+}
+
+// ReverseWithdrawal отменяет списание: возвращает баллы на баланс и в
+// партии, из которых они были списаны, помечает списание отмененным
+// и пишет запись аудита и событие вебхука в той же транзакции
+func (store SQLStore) ReverseWithdrawal(ctx context.Context, reversal WithdrawalReversal) (_ WithdrawResponse, err error) {
+	defer observe(ctx, "ReverseWithdrawal")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	var id int64
+	var amount int
+	var reversed bool
+	result := WithdrawResponse{OrderNumber: strconv.FormatUint(reversal.OrderNumber, 10)}
+	// при нескольких списаниях по одному заказу отменяется последнее действующее
+	err = tx.QueryRow(ctx, `SELECT o.id, o.customer, o.withdrawal, o.created 
+	FROM orders o 
+	LEFT JOIN withdrawal_reversals r ON r.withdrawal_id = o.id 
+	WHERE o.order_number = $1 AND o.withdrawal > 0 AND ($2 = '' OR o.customer = $2) 
+	ORDER BY r.id IS NOT NULL, o.id DESC 
+	LIMIT 1 
+	FOR UPDATE OF o`, reversal.OrderNumber, reversal.Customer).
+		Scan(&id, &result.Login, &amount, &result.ProcessedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WithdrawResponse{}, ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	// отмена проверяется после блокировки строки списания: параллельная
+	// отмена, дождавшаяся блокировки, видна только новому запросу
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM withdrawal_reversals WHERE withdrawal_id = $1)`, id).Scan(&reversed)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	if reversed {
+		return WithdrawResponse{}, ErrAlreadyReversed
+	}
+	if reversal.Window > 0 {
+		processedAt, err := time.Parse(time.RFC3339, result.ProcessedAt)
+		if err != nil || time.Since(processedAt) > reversal.Window {
+			return WithdrawResponse{}, ErrCancelWindowClosed
+		}
+	}
+	_, err = tx.Exec(ctx, `UPDATE users 
+	SET accrual_points = accrual_points + $1, withdrawal = withdrawal - $1 
+	WHERE login = $2`, amount, result.Login)
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	if err = restoreLots(ctx, tx, id, amount); err != nil {
+		return WithdrawResponse{}, err
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, `INSERT INTO withdrawal_reversals 
+	(withdrawal_id, customer, order_number, amount, actor, role, reason, created_at) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		id, result.Login, reversal.OrderNumber, amount, reversal.Actor, reversal.Role, reversal.Reason, now)
+	if isUniqueViolation(err) {
+		return WithdrawResponse{}, ErrAlreadyReversed
+	}
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	result.Amount = float64(amount) / 100
+	details, err := json.Marshal(map[string]any{"sum": result.Amount, "reason": reversal.Reason})
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	err = writeAudit(ctx, tx, AuditEntry{
+		Actor:   reversal.Actor,
+		Role:    reversal.Role,
+		Action:  AuditWithdrawalReversed,
+		Subject: result.Login,
+		Object:  result.OrderNumber,
+		Details: string(details),
+	})
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	err = enqueueWebhook(ctx, tx, result.Login, WebhookPayload{
+		Event:       WebhookWithdrawalReversed,
+		OrderNumber: result.OrderNumber,
+		Sum:         result.Amount,
+	})
+	if err != nil {
+		return WithdrawResponse{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return WithdrawResponse{}, err
+	}
+	result.Status = WithdrawalReversed
+	result.ReversedAt = now.Format(time.RFC3339)
+	return result, nil
+}
+
+// restoreLots возвращает в партии до amount баллов, списанных списанием
+// withdrawalID. Партии, срок которых уже истек, сгорят при следующем
+// запуске ExpirePoints
+func restoreLots(ctx context.Context, tx pgx.Tx, withdrawalID int64, amount int) error {
+	rows, err := tx.Query(ctx, `SELECT id, lot_id, amount 
+	FROM withdrawal_lots 
+	WHERE withdrawal_id = $1 AND amount > 0 
+	ORDER BY id DESC 
+	FOR UPDATE`, withdrawalID)
+	if err != nil {
+		return err
+	}
+	type used struct {
+		id     int64
+		lotID  int64
+		amount int
+	}
+	var parts []used
+	for rows.Next() {
+		var u used
+		if err := rows.Scan(&u.id, &u.lotID, &u.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		parts = append(parts, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	// возвращается не больше, чем было списано из каждой партии,
+	// начиная с последних списанных
+	withdrawn := make([]int, len(parts))
+	for i, part := range parts {
+		withdrawn[i] = part.amount
+	}
+	for i, give := range takeInOrder(withdrawn, amount) {
+		if give == 0 {
+			continue
+		}
+		_, err = tx.Exec(ctx, `UPDATE accrual_lots SET remaining = remaining + $1 WHERE id = $2`, give, parts[i].lotID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE withdrawal_lots SET amount = amount - $1 WHERE id = $2`, give, parts[i].id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentWithdrawalReversals(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "user", 10000)
+	_, err := store.WithdrawFromUser(userContext("user"), WithdrawRequest{OrderNumber: "2377225624", Amount: 30})
+	require.NoError(t, err)
+
+	const attempts = 5
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.ReverseWithdrawal(userContext("admin"), WithdrawalReversal{
+				OrderNumber: 2377225624,
+				Actor:       "admin",
+				Role:        "admin",
+				Reason:      "refund",
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var reversed int
+	for err := range errs {
+		if err == nil {
+			reversed++
+			continue
+		}
+		require.ErrorIs(t, err, ErrAlreadyReversed)
+	}
+	assert.Equal(t, 1, reversed, "the withdrawal is reversed exactly once")
+	assert.Equal(t, 10000, userBalance(t, store, "user"))
+}
+
+func TestReversalRestoresLotsOfThatWithdrawal(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "user", 300)
+	older := addTestLot(t, store, "user", 100, 48*time.Hour)
+	newer := addTestLot(t, store, "user", 200, 24*time.Hour)
+	for i := 0; i < 2; i++ {
+		_, err := store.WithdrawFromUser(userContext("user"), WithdrawRequest{OrderNumber: "2377225624", Amount: 1})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, lotRemaining(t, store, older))
+	require.Equal(t, 100, lotRemaining(t, store, newer))
+
+	_, err := store.ReverseWithdrawal(userContext("user"), WithdrawalReversal{
+		OrderNumber: 2377225624,
+		Customer:    "user",
+		Actor:       "user",
+		Role:        "user",
+		Reason:      "cancelled by user",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, lotRemaining(t, store, older), "the first withdrawal stays in place")
+	assert.Equal(t, 200, lotRemaining(t, store, newer), "the reversed withdrawal returns to its lot")
+	assert.Equal(t, 200, userBalance(t, store, "user"))
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/loyalty"
+)
+
+// Tiers - уровни программы лояльности, задаются конфигурацией (loyalty_tiers)
+var Tiers = loyalty.Default
+
+// Направления смены уровня
+const (
+	TierUpgrade   = "upgrade"
+	TierDowngrade = "downgrade"
+)
+
+// TierInfo - уровень пользователя в ответе о балансе
+type TierInfo struct {
+	Name       string  `json:"name"`
+	Multiplier float64 `json:"multiplier"`
+	// начисления за последние loyalty.Window месяцев без множителя
+	Accrued float64 `json:"accrued_12m"`
+	// следующий уровень и сколько баллов до него осталось начислить
+	Next   string  `json:"next,omitempty"`
+	ToNext float64 `json:"to_next,omitempty"`
+}
+
+// TierChange - запись истории смены уровня
+type TierChange struct {
+	Login     string  `json:"-"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Direction string  `json:"direction"`
+	Accrued   float64 `json:"accrued_12m"`
+	ChangedAt string  `json:"changed_at"`
+}
+
+// rollingAccrualSQL - начисления без множителя за последние loyalty.Window месяцев
+const rollingAccrualSQL = `SELECT COALESCE(SUM(base_amount), 0)::bigint 
+	FROM accrual_lots 
+	WHERE customer = $1 AND accrued_at > now() - make_interval(months => $2::int)`
+
+func (store SQLStore) tierInfo(ctx context.Context, login string) (TierInfo, error) {
+	var tier string
+	var accrued int
+	err := store.DB.QueryRow(ctx, `SELECT COALESCE(tier, '') FROM users WHERE login = $1`, login).Scan(&tier)
+	if err != nil {
+		return TierInfo{}, err
+	}
+	err = store.DB.QueryRow(ctx, rollingAccrualSQL, login, loyalty.Window).Scan(&accrued)
+	if err != nil {
+		return TierInfo{}, err
+	}
+	current := Tiers.ByName(tier)
+	info := TierInfo{
+		Name:       current.Name,
+		Multiplier: current.Multiplier,
+		Accrued:    float64(accrued) / 100,
+	}
+	if next, ok := Tiers.Next(current.Name); ok {
+		info.Next = next.Name
+		info.ToNext = max(next.MinAccrual-info.Accrued, 0)
+	}
+	return info, nil
+}
+
+// RecalculateTiers пересчитывает уровни всех пользователей по начислениям
+// за последние loyalty.Window месяцев и записывает изменения в историю
+func (store SQLStore) RecalculateTiers(ctx context.Context) (_ []TierChange, err error) {
+	defer observe(ctx, "RecalculateTiers")(&err)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, `SELECT u.login, COALESCE(u.tier, ''), COALESCE(SUM(l.base_amount), 0)::bigint 
+	FROM users u 
+	LEFT JOIN accrual_lots l 
+	ON l.customer = u.login AND l.accrued_at > now() - make_interval(months => $1::int) 
+	GROUP BY u.login, u.tier`, loyalty.Window)
+	if err != nil {
+		return nil, err
+	}
+	var changes []TierChange
+	var accruedCents []int
+	for rows.Next() {
+		var login, tier string
+		var accrued int
+		if err := rows.Scan(&login, &tier, &accrued); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		from := Tiers.ByName(tier)
+		to := Tiers.For(float64(accrued) / 100)
+		if from.Name == to.Name {
+			continue
+		}
+		direction := TierUpgrade
+		if to.MinAccrual < from.MinAccrual {
+			direction = TierDowngrade
+		}
+		changes = append(changes, TierChange{
+			Login:     login,
+			From:      from.Name,
+			To:        to.Name,
+			Direction: direction,
+			Accrued:   float64(accrued) / 100,
+		})
+		accruedCents = append(accruedCents, accrued)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i, change := range changes {
+		_, err = tx.Exec(ctx, `UPDATE users SET tier = $1 WHERE login = $2`, change.To, change.Login)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO tier_history 
+		(customer, from_tier, to_tier, direction, accrued, changed_at) 
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+			change.Login, change.From, change.To, change.Direction, accruedCents[i], now)
+		if err != nil {
+			return nil, err
+		}
+		changes[i].ChangedAt = now.Format(time.RFC3339)
+	}
+	return changes, tx.Commit(ctx)
+}
+
+// GetTierHistory возвращает историю смены уровня пользователя, от новых к старым
+func (store SQLStore) GetTierHistory(ctx context.Context) (_ []TierChange, err error) {
+	defer observe(ctx, "GetTierHistory")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	rows, err := store.DB.Query(ctx, `SELECT from_tier, to_tier, direction, accrued, changed_at 
+	FROM tier_history 
+	WHERE customer = $1 
+	ORDER BY id DESC`, userLogin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []TierChange
+	for rows.Next() {
+		change := TierChange{Login: userLogin}
+		var accrued int
+		var changedAt time.Time
+		if err := rows.Scan(&change.From, &change.To, &change.Direction, &accrued, &changedAt); err != nil {
+			return result, err
+		}
+		change.Accrued = float64(accrued) / 100
+		change.ChangedAt = changedAt.Format(time.RFC3339)
+		result = append(result, change)
+	}
+	return result, rows.Err()
+}
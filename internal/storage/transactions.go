@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы операций в ленте GET /api/user/transactions
+const (
+	TxAccrual            = "accrual"
+	TxAccrualReversal    = "accrual_reversal"
+	TxWithdrawal         = "withdrawal"
+	TxWithdrawalReversal = "withdrawal_reversal"
+	TxExpiry             = "expiry"
+	TxTransferIn         = "transfer_in"
+	TxTransferOut        = "transfer_out"
+	TxAdjustment         = "adjustment"
+)
+
+// AdjustmentDebtRepayment - причина корректировки, когда долг от
+// отмененного начисления гасится из нового начисления
+const AdjustmentDebtRepayment = "debt repayment"
+
+// ErrInvalidCursor - курсор ленты операций поврежден или подделан
+var ErrInvalidCursor = errors.New("invalid transactions cursor")
+
+// Transaction - движение баллов. Cursor - позиция операции в ленте,
+// Amount - изменение баланса со знаком, Balance - баланс после операции
+type Transaction struct {
+	Cursor       string  `json:"cursor"`
+	Type         string  `json:"type"`
+	OrderNumber  string  `json:"order,omitempty"`
+	Counterparty string  `json:"counterparty,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+	Amount       float64 `json:"sum"`
+	Balance      float64 `json:"balance"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// TxCursor - ключ операции в ленте: лента упорядочена по (At, Kind, ID),
+// поэтому новые операции не сдвигают уже выданные страницы.
+// Нулевой курсор указывает на начало ленты
+type TxCursor struct {
+	At   time.Time
+	Kind string
+	ID   int64
+}
+
+// String кодирует курсор для передачи клиенту
+func (c TxCursor) String() string {
+	raw := strconv.FormatInt(c.At.UnixMicro(), 10) + ":" + c.Kind + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseTxCursor разбирает курсор, выданный в поле cursor
+func ParseTxCursor(value string) (TxCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return TxCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return TxCursor{}, ErrInvalidCursor
+	}
+	at, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return TxCursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || parts[1] == "" {
+		return TxCursor{}, ErrInvalidCursor
+	}
+	return TxCursor{At: time.UnixMicro(at).UTC(), Kind: parts[1], ID: id}, nil
+}
+
+// transactionsSQL собирает движения баллов из таблиц начислений, списаний,
+// отмен, сгораний, переводов и корректировок. Начисления берутся из заказов
+// с множителем уровня из партии, как они зачислены на баланс. opening -
+// баланс до первой операции страницы
+const transactionsSQL = `WITH movements AS (
+	SELECT 'accrual' AS kind, o.id, o.order_number, COALESCE(l.amount, o.accrual_points) AS amount,
+	'' AS counterparty, '' AS reason, COALESCE(l.accrued_at, o.created_at) AS at
+	FROM orders o
+	LEFT JOIN accrual_lots l ON l.customer = o.customer AND l.order_number = o.order_number
+	WHERE o.customer = $1 AND o.withdrawal = 0 AND o.accrual_points > 0
+	UNION ALL
+	SELECT 'withdrawal', id, order_number, -withdrawal, '', '', created_at
+	FROM orders WHERE customer = $1 AND withdrawal > 0
+	UNION ALL
+	SELECT 'withdrawal_reversal', id, order_number, amount, '', reason, created_at
+	FROM withdrawal_reversals WHERE customer = $1
+	UNION ALL
+	SELECT 'accrual_reversal', id, order_number, -debited, '', reason, created_at
+	FROM accrual_reversals WHERE customer = $1
+	UNION ALL
+	SELECT 'expiry', e.id, l.order_number, -e.amount, '', '', e.expired_at
+	FROM point_expirations e JOIN accrual_lots l ON l.id = e.lot_id WHERE e.customer = $1
+	UNION ALL
+	SELECT 'transfer_in', id, 0, amount, sender, '', completed_at
+	FROM transfers WHERE recipient = $1 AND state = 'COMPLETED'
+	UNION ALL
+	SELECT 'transfer_out', id, 0, -amount, recipient, '', completed_at
+	FROM transfers WHERE sender = $1 AND state = 'COMPLETED'
+	UNION ALL
+	SELECT 'adjustment', id, order_number, amount, '', reason, created_at
+	FROM balance_adjustments WHERE customer = $1
+)
+SELECT m.kind, m.id, m.order_number, m.amount::bigint, m.counterparty, m.reason, m.at, b.opening
+FROM movements m, (
+	SELECT COALESCE(SUM(amount), 0)::bigint AS opening
+	FROM movements
+	WHERE (at, kind, id) <= ($2, $3, $4)
+) b
+WHERE (m.at, m.kind, m.id) > ($2, $3, $4)
+ORDER BY m.at, m.kind, m.id
+LIMIT $5`
+
+// runningBalance - баланс после каждой из amounts, начиная с opening
+func runningBalance(opening int, amounts []int) []int {
+	result := make([]int, len(amounts))
+	for i, amount := range amounts {
+		opening += amount
+		result[i] = opening
+	}
+	return result
+}
+
+// GetTransactions возвращает до limit операций пользователя после
+// операции с курсором after, от старых к новым
+func (store SQLStore) GetTransactions(ctx context.Context, after TxCursor, limit int) (_ []Transaction, err error) {
+	defer observe(ctx, "GetTransactions")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	rows, err := store.DB.Query(ctx, transactionsSQL, userLogin, after.At, after.Kind, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []Transaction
+	var amounts []int
+	var opening int
+	for rows.Next() {
+		var t Transaction
+		var key TxCursor
+		var orderNumber uint64
+		var amount int
+		if err := rows.Scan(&key.Kind, &key.ID, &orderNumber, &amount, &t.Counterparty, &t.Reason, &key.At, &opening); err != nil {
+			return result, err
+		}
+		t.Cursor = key.String()
+		t.Type = key.Kind
+		if orderNumber != 0 {
+			t.OrderNumber = strconv.FormatUint(orderNumber, 10)
+		}
+		t.Amount = float64(amount) / 100
+		t.CreatedAt = key.At.Format(time.RFC3339)
+		amounts = append(amounts, amount)
+		result = append(result, t)
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+	for i, balance := range runningBalance(opening, amounts) {
+		result[i].Balance = float64(balance) / 100
+	}
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunningBalance(t *testing.T) {
+	assert.Equal(t, []int{}, runningBalance(0, nil))
+	assert.Equal(t, []int{500, 380, 880}, runningBalance(0, []int{500, -120, 500}))
+	assert.Equal(t, []int{1380, 1000}, runningBalance(1500, []int{-120, -380}), "continues from the previous page")
+}
+
+func TestTxCursor(t *testing.T) {
+	cursor := TxCursor{At: time.Date(2024, 3, 1, 10, 0, 0, 123456000, time.UTC), Kind: TxWithdrawalReversal, ID: 42}
+	parsed, err := ParseTxCursor(cursor.String())
+	require.NoError(t, err)
+	assert.True(t, cursor.At.Equal(parsed.At), "microseconds survive the round trip")
+	assert.Equal(t, cursor.Kind, parsed.Kind)
+	assert.Equal(t, cursor.ID, parsed.ID)
+
+	for _, value := range []string{"12", "!!!", cursor.String()[1:]} {
+		_, err = ParseTxCursor(value)
+		assert.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
+	"github.com/jackc/pgx/v5"
+)
+
+// Состояния перевода баллов
+const (
+	TransferPending   = "PENDING"
+	TransferCompleted = "COMPLETED"
+	TransferExpired   = "EXPIRED"
+)
+
+// Направления перевода относительно пользователя
+const (
+	TransferIn  = "in"
+	TransferOut = "out"
+)
+
+var (
+	ErrRecipientNotFound  = errors.New("recipient not found")
+	ErrTransferLimit      = errors.New("daily transfer limit exceeded")
+	ErrPointsOnHold       = errors.New("points are on hold")
+	ErrTransferNotFound   = errors.New("transfer not found")
+	ErrTransferExpired    = errors.New("transfer confirmation expired")
+	ErrTransferNotPending = errors.New("transfer is not waiting for confirmation")
+)
+
+// TransferLimits - ограничения переводов в копейках, задаются конфигурацией
+type TransferLimits struct {
+	// сумма переводов пользователя за последние сутки
+	Daily int
+	// переводы от этой суммы ждут подтверждения паролем
+	ConfirmFrom int
+	// сколько перевод ждет подтверждения
+	ConfirmTTL time.Duration
+	// сколько полученные переводом баллы нельзя перевести дальше
+	Hold time.Duration
+}
+
+// Transfers - действующие ограничения переводов
+var Transfers = TransferLimits{
+	Daily:       100000,
+	ConfirmFrom: 50000,
+	ConfirmTTL:  10 * time.Minute,
+	Hold:        24 * time.Hour,
+}
+
+type TransferRequest struct {
+	To     string  `json:"to"`
+	Amount float64 `json:"sum"`
+}
+
+type TransferResponse struct {
+	ID        int64   `json:"id"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Direction string  `json:"direction"`
+	Amount    float64 `json:"sum"`
+	State     string  `json:"status"`
+	CreatedAt string  `json:"created_at"`
+	// до какого момента перевод можно подтвердить
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+type transferRow struct {
+	id          int64
+	sender      string
+	recipient   string
+	amount      int
+	state       string
+	createdAt   time.Time
+	completedAt *time.Time
+}
+
+func (t transferRow) response(login string) TransferResponse {
+	result := TransferResponse{
+		ID:        t.id,
+		From:      t.sender,
+		To:        t.recipient,
+		Direction: TransferOut,
+		Amount:    float64(t.amount) / 100,
+		State:     t.state,
+		CreatedAt: t.createdAt.Format(time.RFC3339),
+	}
+	if t.recipient == login {
+		result.Direction = TransferIn
+	}
+	if t.state == TransferPending {
+		result.ExpiresAt = t.createdAt.Add(Transfers.ConfirmTTL).Format(time.RFC3339)
+	}
+	if t.completedAt != nil {
+		result.CompletedAt = t.completedAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// CreateTransfer переводит баллы пользователю transfer.To. Перевод от
+// Transfers.ConfirmFrom не выполняется сразу, а ждет ConfirmTransfer
+func (store SQLStore) CreateTransfer(ctx context.Context, transfer TransferRequest) (_ TransferResponse, err error) {
+	defer observe(ctx, "CreateTransfer")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return TransferResponse{}, ErrNoLogin
+	}
+	amount := Cents(transfer.Amount)
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	var recipient string
+	err = tx.QueryRow(ctx, `SELECT login FROM users WHERE login = $1`, transfer.To).Scan(&recipient)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TransferResponse{}, ErrRecipientNotFound
+	}
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	// строка отправителя блокируется до подсчета суммы за сутки, иначе
+	// параллельные переводы вместе превысят лимит
+	if err = lockTransferable(ctx, tx, userLogin, recipient, amount); err != nil {
+		return TransferResponse{}, err
+	}
+	var sentToday int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0)::bigint 
+	FROM transfers 
+	WHERE sender = $1 AND state IN ('PENDING', 'COMPLETED') AND created_at > now() - interval '1 day'`,
+		userLogin).Scan(&sentToday)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	if sentToday+amount > Transfers.Daily {
+		return TransferResponse{}, ErrTransferLimit
+	}
+	row := transferRow{sender: userLogin, recipient: recipient, amount: amount, state: TransferPending}
+	err = tx.QueryRow(ctx, `INSERT INTO transfers (sender, recipient, amount, state, created_at) 
+	VALUES ($1, $2, $3, $4, now()) 
+	RETURNING id, created_at`, row.sender, row.recipient, row.amount, row.state).Scan(&row.id, &row.createdAt)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	if amount < Transfers.ConfirmFrom {
+		if err = completeTransfer(ctx, tx, &row); err != nil {
+			return TransferResponse{}, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return TransferResponse{}, err
+	}
+	if row.state == TransferCompleted {
+		metrics.PointsTransferred.Add(float64(amount) / 100)
+	}
+	return row.response(userLogin), nil
+}
+
+// ConfirmTransfer выполняет перевод, ожидающий подтверждения
+func (store SQLStore) ConfirmTransfer(ctx context.Context, id int64) (_ TransferResponse, err error) {
+	defer observe(ctx, "ConfirmTransfer")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return TransferResponse{}, ErrNoLogin
+	}
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+	row := transferRow{id: id}
+	err = tx.QueryRow(ctx, `SELECT sender, recipient, amount, state, created_at 
+	FROM transfers 
+	WHERE id = $1 AND sender = $2 
+	FOR UPDATE`, id, userLogin).Scan(&row.sender, &row.recipient, &row.amount, &row.state, &row.createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TransferResponse{}, ErrTransferNotFound
+	}
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	if row.state != TransferPending {
+		return row.response(userLogin), ErrTransferNotPending
+	}
+	if time.Since(row.createdAt) > Transfers.ConfirmTTL {
+		_, err = tx.Exec(ctx, `UPDATE transfers SET state = $1 WHERE id = $2`, TransferExpired, id)
+		if err != nil {
+			return TransferResponse{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return TransferResponse{}, err
+		}
+		row.state = TransferExpired
+		return row.response(userLogin), ErrTransferExpired
+	}
+	if err = lockTransferable(ctx, tx, userLogin, row.recipient, row.amount); err != nil {
+		return TransferResponse{}, err
+	}
+	if err = completeTransfer(ctx, tx, &row); err != nil {
+		return TransferResponse{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return TransferResponse{}, err
+	}
+	metrics.PointsTransferred.Add(float64(row.amount) / 100)
+	return row.response(userLogin), nil
+}
+
+// lockTransferable блокирует строки отправителя и получателя и проверяет,
+// что amount не превышает баланс за вычетом резервов и баллов, полученных
+// переводами за последние Transfers.Hold. Строки блокируются в порядке
+// логинов, чтобы встречные переводы A->B и B->A не ждали друг друга по кругу
+func lockTransferable(ctx context.Context, tx pgx.Tx, login, recipient string, amount int) error {
+	var balance, received int
+	rows, err := tx.Query(ctx, `SELECT login, accrual_points FROM users 
+	WHERE login IN ($1, $2) 
+	ORDER BY login 
+	FOR UPDATE`, login, recipient)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var rowLogin string
+		var points int
+		if err = rows.Scan(&rowLogin, &points); err != nil {
+			rows.Close()
+			return err
+		}
+		if rowLogin == login {
+			balance = points
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	reserved, err := heldPoints(ctx, tx, login)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0)::bigint 
+	FROM transfers 
+	WHERE recipient = $1 AND state = 'COMPLETED' AND completed_at > now() - make_interval(secs => $2)`,
+		login, Transfers.Hold.Seconds()).Scan(&received)
+	if err != nil {
+		return err
+	}
+	return checkTransferable(balance, reserved, received, amount)
+}
+
+// checkTransferable - зарезервированные под списания баллы переводить
+// нельзя совсем, недавно полученные переводом - до истечения Transfers.Hold
+func checkTransferable(balance, reserved, received, amount int) error {
+	available := balance - reserved
+	if available < amount {
+		return ErrInsufficientFunds
+	}
+	if available-received < amount {
+		return ErrPointsOnHold
+	}
+	return nil
+}
+
+// completeTransfer переносит баллы вместе со сроками сгорания
+// списанных партий. Строки отправителя и получателя уже заблокированы
+func completeTransfer(ctx context.Context, tx pgx.Tx, row *transferRow) error {
+	var balance int
+	err := tx.QueryRow(ctx, `SELECT accrual_points FROM users WHERE login = $1`, row.sender).Scan(&balance)
+	if err != nil {
+		return err
+	}
+	parts, err := consumeLots(ctx, tx, row.sender, balance, row.amount)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE users SET accrual_points = accrual_points - $1 WHERE login = $2`, row.amount, row.sender)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE users SET accrual_points = accrual_points + $1 WHERE login = $2`, row.amount, row.recipient)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		_, err = tx.Exec(ctx, `INSERT INTO accrual_lots 
+		(customer, order_number, amount, base_amount, remaining, accrued_at, expires_at) 
+		VALUES ($1, 0, $2, 0, $2, now(), $3)`, row.recipient, part.amount, part.expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, `UPDATE transfers SET state = $1, completed_at = $2 WHERE id = $3`, TransferCompleted, now, row.id)
+	if err != nil {
+		return err
+	}
+	row.state = TransferCompleted
+	row.completedAt = &now
+	return nil
+}
+
+// GetTransfers возвращает входящие и исходящие переводы пользователя, от новых к старым
+func (store SQLStore) GetTransfers(ctx context.Context) (_ []TransferResponse, err error) {
+	defer observe(ctx, "GetTransfers")(&err)
+	userLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	// входящие видны только после зачисления
+	rows, err := store.DB.Query(ctx, `SELECT id, sender, recipient, amount, state, created_at, completed_at 
+	FROM transfers 
+	WHERE sender = $1 OR (recipient = $1 AND state = 'COMPLETED') 
+	ORDER BY id DESC`, userLogin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []TransferResponse
+	for rows.Next() {
+		var row transferRow
+		if err := rows.Scan(&row.id, &row.sender, &row.recipient, &row.amount, &row.state, &row.createdAt, &row.completedAt); err != nil {
+			return result, err
+		}
+		result = append(result, row.response(userLogin))
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTransferable(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  int
+		reserved int
+		received int
+		amount   int
+		exp      error
+	}{
+		{"enough points", 1000, 0, 0, 1000, nil},
+		{"over balance", 1000, 0, 0, 1001, ErrInsufficientFunds},
+		{"reserved points", 1000, 300, 0, 800, ErrInsufficientFunds},
+		{"received points on hold", 1000, 0, 400, 700, ErrPointsOnHold},
+		{"own points besides received", 1000, 0, 400, 600, nil},
+		{"reserved and received", 1000, 300, 400, 300, nil},
+		{"reserved and received over", 1000, 300, 400, 301, ErrPointsOnHold},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.exp, checkTransferable(test.balance, test.reserved, test.received, test.amount))
+		})
+	}
+}
+
+func TestCounterTransfersDoNotDeadlock(t *testing.T) {
+	store := testStore(t)
+	addTestUser(t, store, "alice", 10000)
+	addTestUser(t, store, "bob", 10000)
+
+	const rounds = 20
+	errs := make(chan error, 2*rounds)
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+			wg.Add(1)
+			go func(from, to string) {
+				defer wg.Done()
+				_, err := store.CreateTransfer(userContext(from), TransferRequest{To: to, Amount: 1})
+				errs <- err
+			}(pair[0], pair[1])
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10000, userBalance(t, store, "alice"))
+	assert.Equal(t, 10000, userBalance(t, store, "bob"))
+}
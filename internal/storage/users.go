@@ -4,56 +4,73 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"time"
 
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/metrics"
 	"github.com/Azcarot/GopherMarketProject/internal/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap/zapcore"
 )
 
+var ErrUnauthorized = errors.New("missing or invalid authorization token")
+
+const tokenTTL = 72 * time.Hour
+
 type RegisterRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
-func (store SQLStore) CreateNewUser(ctx context.Context, data UserData) error {
+// MarshalLogObject не пускает пароль в структурированный лог
+func (r RegisterRequest) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("login", r.Login)
+	enc.AddString("password", logger.Redacted)
+	return nil
+}
+
+// MarshalLogObject не пускает пароль в структурированный лог
+func (data UserData) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("login", data.Login)
+	enc.AddString("password", logger.Redacted)
+	return nil
+}
+
+func (store SQLStore) CreateNewUser(ctx context.Context, data UserData) (err error) {
+	defer observe(ctx, "CreateNewUser")(&err)
 	encodedPW := utils.ShaData(data.Password, SecretKey)
-	for {
-		select {
-		case <-ctx.Done():
-			return errTimeout
-		default:
-			mut.Lock()
-			defer mut.Unlock()
-			tx, err := store.DB.Begin(ctx)
-			if err != nil {
-				return err
-			}
-
-			_, err = store.DB.Exec(ctx, `INSERT into users (login, password, accrual_points, withdrawal, created) 
+	mut.Lock()
+	defer mut.Unlock()
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT into users (login, password, accrual_points, withdrawal, created) 
 	values ($1, $2, $3, $4, $5);`,
-				data.Login, encodedPW, 0, 0, data.Date)
-
-			if err != nil {
-				tx.Rollback(ctx)
-				return err
-			}
-			err = tx.Commit(ctx)
-			if err != nil {
-				tx.Rollback(ctx)
-				return err
-			}
-			return err
-		}
+		data.Login, encodedPW, 0, 0, data.Date)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
 	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	metrics.Registrations.Inc()
+	return err
 
 }
 
-func (store SQLStore) CheckUserExists(data UserData) (bool, error) {
+func (store SQLStore) CheckUserExists(data UserData) (_ bool, err error) {
+	defer observe(context.Background(), "CheckUserExists")(&err)
 	ctx := context.Background()
 	var login string
 	sqlQuery := fmt.Sprintf(`SELECT login FROM users WHERE login = '%s'`, data.Login)
-	err := store.DB.QueryRow(ctx, sqlQuery).Scan(&login)
+	err = store.DB.QueryRow(ctx, sqlQuery).Scan(&login)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 
@@ -68,11 +85,12 @@ func (store SQLStore) CheckUserExists(data UserData) (bool, error) {
 
 }
 
-func (store SQLStore) CheckUserPassword(ctx context.Context, data UserData) (bool, error) {
+func (store SQLStore) CheckUserPassword(ctx context.Context, data UserData) (_ bool, err error) {
+	defer observe(ctx, "CheckUserPassword")(&err)
 	encodedPw := utils.ShaData(data.Password, SecretKey)
 	sqlQuery := fmt.Sprintf(`SELECT login, password FROM users WHERE login = '%s'`, data.Login)
 	var login, pw string
-	err := store.DB.QueryRow(ctx, sqlQuery).Scan(&login, &pw)
+	err = store.DB.QueryRow(ctx, sqlQuery).Scan(&login, &pw)
 	if err != nil {
 		return false, err
 	}
@@ -84,7 +102,7 @@ func (store SQLStore) CheckUserPassword(ctx context.Context, data UserData) (boo
 }
 
 func VerifyToken(token string) (jwt.MapClaims, bool) {
-	hmacSecretString := SecretKey
+	hmacSecretString := JWTSecret
 	hmacSecret := []byte(hmacSecretString)
 	gettoken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		return hmacSecret, nil
@@ -98,7 +116,38 @@ func VerifyToken(token string) (jwt.MapClaims, bool) {
 		return claims, true
 
 	} else {
-		log.Printf("Invalid JWT Token")
 		return nil, false
 	}
 }
+
+// NewToken выдает пользователю JWT-токен, подписанный по алгоритму HS256
+func NewToken(login string) (string, error) {
+	payload := jwt.MapClaims{
+		"sub": login,
+		"exp": time.Now().Add(tokenTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	return token.SignedString([]byte(JWTSecret))
+}
+
+// Authenticate проверяет токен и существование пользователя
+// и возвращает его логин. Используется HTTP и gRPC API
+func Authenticate(token string) (string, error) {
+	claims, ok := VerifyToken(token)
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	var userData UserData
+	userData.Login, ok = claims["sub"].(string)
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	ok, err := PgxStorage.CheckUserExists(ST, userData)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	return userData.Login, nil
+}
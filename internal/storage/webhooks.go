@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// События, о которых сообщается партнерам через вебхуки
+const (
+	WebhookOrderProcessed     = "order.processed"
+	WebhookOrderInvalid       = "order.invalid"
+	WebhookWithdrawalCreated  = "withdrawal.created"
+	WebhookWithdrawalReversed = "withdrawal.reversed"
+	WebhookOrderReversed      = "order.reversed"
+)
+
+// Состояния доставки в webhook_outbox
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryDead      = "DEAD"
+)
+
+type WebhookData struct {
+	ID     int64  `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	Date   string `json:"created_at"`
+}
+
+type WebhookPayload struct {
+	Event       string  `json:"event"`
+	Login       string  `json:"login"`
+	OrderNumber string  `json:"order"`
+	Status      string  `json:"status,omitempty"`
+	Accrual     float64 `json:"accrual,omitempty"`
+	Sum         float64 `json:"sum,omitempty"`
+	Date        string  `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID          int64
+	Event       string
+	Payload     string
+	URL         string
+	Secret      string
+	State       string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+var orderStateWebhooks = map[string]string{
+	"PROCESSED": WebhookOrderProcessed,
+	"INVALID":   WebhookOrderInvalid,
+}
+
+// enqueueWebhook пишет событие в outbox для всех вебхуков пользователя
+// в рамках переданной транзакции
+func enqueueWebhook(ctx context.Context, tx pgx.Tx, login string, payload WebhookPayload) error {
+	payload.Login = login
+	payload.Date = time.Now().Format(time.RFC3339)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO webhook_outbox 
+	(webhook_id, event, payload, state, attempts, next_attempt, created) 
+	SELECT id, $2, $3, $4, 0, now(), $5 FROM webhooks WHERE customer = $1`,
+		login, payload.Event, string(data), DeliveryPending, payload.Date)
+	return err
+}
+
+func (store SQLStore) CreateWebhook(ctx context.Context, data WebhookData) (_ WebhookData, err error) {
+	defer observe(ctx, "CreateWebhook")(&err)
+	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return data, ErrNoLogin
+	}
+	err = store.DB.QueryRow(ctx, `INSERT INTO webhooks 
+	(customer, url, secret, created) 
+	values ($1, $2, $3, $4) RETURNING id;`,
+		dataLogin, data.URL, data.Secret, data.Date).Scan(&data.ID)
+	return data, err
+}
+
+func (store SQLStore) GetWebhooks(ctx context.Context) (_ []WebhookData, err error) {
+	defer observe(ctx, "GetWebhooks")(&err)
+	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return nil, ErrNoLogin
+	}
+	result := []WebhookData{}
+	rows, err := store.DB.Query(ctx, `SELECT id, url, created FROM webhooks WHERE customer = $1 ORDER BY id`, dataLogin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var webhook WebhookData
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Date); err != nil {
+			return result, err
+		}
+		result = append(result, webhook)
+	}
+	return result, rows.Err()
+}
+
+// DeleteWebhook удаляет вебхук пользователя вместе со всеми его событиями в outbox.
+// Возвращает false, если у пользователя нет такого вебхука
+func (store SQLStore) DeleteWebhook(ctx context.Context, id int64) (_ bool, err error) {
+	defer observe(ctx, "DeleteWebhook")(&err)
+	dataLogin, ok := ctx.Value(UserLoginCtxKey).(string)
+	if !ok {
+		return false, ErrNoLogin
+	}
+	tx, err := store.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND customer = $2`, id, dataLogin)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	// события удаленного вебхука больше некуда доставлять
+	_, err = tx.Exec(ctx, `DELETE FROM webhook_outbox WHERE webhook_id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (store SQLStore) GetPendingDeliveries(ctx context.Context, limit int) (_ []WebhookDelivery, err error) {
+	defer observe(ctx, "GetPendingDeliveries")(&err)
+	var result []WebhookDelivery
+	rows, err := store.DB.Query(ctx, `SELECT webhook_outbox.id, webhook_outbox.event, webhook_outbox.payload, 
+	webhook_outbox.attempts, webhooks.url, webhooks.secret 
+	FROM webhook_outbox 
+	JOIN webhooks ON webhooks.id = webhook_outbox.webhook_id 
+	WHERE webhook_outbox.state = $1 AND webhook_outbox.next_attempt <= now() 
+	ORDER BY webhook_outbox.id 
+	LIMIT $2`, DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var delivery WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.Event, &delivery.Payload,
+			&delivery.Attempts, &delivery.URL, &delivery.Secret); err != nil {
+			return result, err
+		}
+		delivery.State = DeliveryPending
+		result = append(result, delivery)
+	}
+	return result, rows.Err()
+}
+
+func (store SQLStore) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) (err error) {
+	defer observe(ctx, "UpdateDelivery")(&err)
+	_, err = store.DB.Exec(ctx, `UPDATE webhook_outbox 
+	SET state = $1, attempts = $2, next_attempt = $3, last_error = $4 
+	WHERE id = $5`,
+		delivery.State, delivery.Attempts, delivery.NextAttempt, delivery.LastError, delivery.ID)
+	return err
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteWebhookRemovesItsOutbox(t *testing.T) {
+	store := testStore(t)
+	ctx := userContext("partner")
+	hook, err := store.CreateWebhook(ctx, WebhookData{URL: "https://example.com/hook", Secret: "secret"})
+	require.NoError(t, err)
+	other, err := store.CreateWebhook(userContext("other"), WebhookData{URL: "https://example.com/other", Secret: "secret"})
+	require.NoError(t, err)
+	for _, webhook := range []int64{hook.ID, hook.ID, hook.ID, other.ID} {
+		_, err = store.DB.Exec(context.Background(), `INSERT INTO webhook_outbox
+		(webhook_id, event, payload, state, attempts, next_attempt)
+		VALUES ($1, $2, '{}', $3, 0, now())`, webhook, WebhookOrderProcessed, DeliveryPending)
+		require.NoError(t, err)
+	}
+	_, err = store.DB.Exec(context.Background(), `UPDATE webhook_outbox SET state = $1
+	WHERE id = (SELECT min(id) FROM webhook_outbox WHERE webhook_id = $2)`, DeliveryDead, hook.ID)
+	require.NoError(t, err)
+
+	deleted, err := store.DeleteWebhook(ctx, hook.ID)
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	var left, kept int
+	err = store.DB.QueryRow(context.Background(), `SELECT count(*) FILTER (WHERE webhook_id = $1),
+	count(*) FILTER (WHERE webhook_id = $2) FROM webhook_outbox`, hook.ID, other.ID).Scan(&left, &kept)
+	require.NoError(t, err)
+	require.Zero(t, left, "pending and dead events of the deleted webhook must be removed")
+	require.Equal(t, 1, kept, "events of other webhooks must stay")
+}
@@ -0,0 +1,145 @@
+// Package tlsreload отдает серверу TLS-сертификат, который можно
+// перечитать с диска без перезапуска и без разрыва открытых соединений
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+)
+
+// Reloader хранит текущую пару сертификат/ключ. Новые TLS-рукопожатия
+// получают актуальный сертификат, уже открытые соединения не затрагиваются
+type Reloader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// New загружает сертификат и ключ
+func New(certPath, keyPath string) (*Reloader, error) {
+	r := &Reloader{certPath: certPath, keyPath: keyPath}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает файлы. При ошибке остается прежний сертификат
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate подходит для tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch перечитывает сертификат по SIGHUP и при изменении файлов,
+// которое проверяется раз в interval. Блокируется до отмены ctx
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	log := logger.Default().With("cert", r.certPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.Reload(); err != nil {
+				log.Errorw("TLS certificate reload failed, keeping the previous one", "error", err)
+				continue
+			}
+			log.Infow("TLS certificate reloaded", "trigger", "SIGHUP")
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil || !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Errorw("TLS certificate reload failed, keeping the previous one", "error", err)
+				continue
+			}
+			log.Infow("TLS certificate reloaded", "trigger", "file change")
+		}
+	}
+}
+
+func (r *Reloader) changed() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime.Equal(r.modTime), nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ServerConfig собирает tls.Config с HTTP/2 и перезагружаемым сертификатом.
+// Если задан clientCAPath, клиентские сертификаты проверяются по этому CA,
+// но обязательными становятся только там, где стоит
+// middleware.RequireClientCert
+func ServerConfig(r *Reloader, clientCAPath string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if clientCAPath == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("client CA file contains no PEM certificates")
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
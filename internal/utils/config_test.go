@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+address: ":9000"
+log_level: debug
+poll_interval: 5s
+ws_max_conns: 7
+route_timeouts:
+  "POST /api/user/orders/batch": 45s
+rate_limit:
+  requests: 50
+rate_limits:
+  "POST /api/user/orders": {requests: 5, period: 10s}
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+
+	f, err := LoadConfig([]string{"-c", path, "-a", ":7000", "-rate-limit-period", "30s"})
+	require.NoError(t, err)
+	assert.Equal(t, ":7000", f.FlagAddr, "flags override the file")
+	assert.Equal(t, "warn", f.FlagLogLevel, "env overrides the file")
+	assert.Equal(t, 5*time.Second, f.FlagPollInterval, "file overrides defaults")
+	assert.Equal(t, 7, f.FlagWSMaxConns)
+	assert.Equal(t, "console", f.FlagLogFormat, "defaults are kept")
+	assert.Equal(t, map[string]time.Duration{"POST /api/user/orders/batch": 45 * time.Second}, f.FlagRouteTimeouts)
+	assert.Equal(t, RateLimit{Requests: 50, Period: 30 * time.Second}, f.FlagRateLimit)
+	assert.Equal(t, map[string]RateLimit{"POST /api/user/orders": {Requests: 5, Period: 10 * time.Second}}, f.FlagRateLimits)
+}
+
+func TestLoadConfigJSONFromEnv(t *testing.T) {
+	path := writeConfig(t, "config.json", `{"accrual_address": "http://accrual:8080", "trace_exporter": "stdout"}`)
+	t.Setenv("CONFIG", path)
+
+	f, err := LoadConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://accrual:8080", f.FlagAccrualAddr)
+	assert.Equal(t, "stdout", f.FlagTraceExporter)
+	assert.Equal(t, path, f.FlagConfigPath)
+}
+
+func TestLoadConfigRoles(t *testing.T) {
+	path := writeConfig(t, "roles.yaml", "admin_logins: [root]\npartner_logins: [shop]\n")
+	t.Setenv("PARTNER_LOGINS", "shop-a,shop-b")
+
+	f, err := LoadConfig([]string{"-c", path, "-admin-logins", "ops, root"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ops", "root"}, f.FlagAdminLogins)
+	assert.Equal(t, []string{"shop-a", "shop-b"}, f.FlagPartnerLogins)
+}
+
+func TestLoadConfigEnvZeroValues(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "dev: true\npoints_expiry_months: 12\ntls_cert: cert.pem\ntls_key: key.pem\n")
+	t.Setenv("DEV_MODE", "false")
+	t.Setenv("POINTS_EXPIRY_MONTHS", "0")
+	t.Setenv("TLS_CERT", "")
+	t.Setenv("TLS_KEY", "")
+
+	f, err := LoadConfig([]string{"-c", path})
+	require.NoError(t, err)
+	assert.False(t, f.FlagDevMode, "env overrides the file with false")
+	assert.Equal(t, 0, f.FlagPointsExpiryMonths, "env overrides the file with zero")
+	assert.Empty(t, f.FlagTLSCert, "env overrides the file with an empty string")
+}
+
+func TestLoadConfigDefaultJWTSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	os.Unsetenv("JWT_SECRET")
+
+	f, err := LoadConfig(nil)
+	require.NoError(t, err, "the default secret does not stop the server")
+	assert.True(t, f.InsecureJWTSecret())
+
+	f, err = LoadConfig([]string{"-dev"})
+	require.NoError(t, err)
+	assert.False(t, f.InsecureJWTSecret(), "the default secret is fine in dev mode")
+
+	f, err = LoadConfig([]string{"-jwt-secret", "prod-secret"})
+	require.NoError(t, err)
+	assert.False(t, f.InsecureJWTSecret())
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	_, err := LoadConfig([]string{"-c", writeConfig(t, "typo.yaml", "adress: x\n")})
+	assert.ErrorContains(t, err, "field adress not found")
+
+	_, err = LoadConfig([]string{"-c", writeConfig(t, "routes.yaml", "route_timeouts:\n  /api/user/orders: 2m\n")})
+	assert.ErrorContains(t, err, "route_timeouts")
+
+	_, err = LoadConfig([]string{"-c", writeConfig(t, "limits.yaml", "rate_limits:\n  \"POST /api/user/orders\": {requests: 5}\n")})
+	assert.ErrorContains(t, err, "period must be positive")
+
+	_, err = LoadConfig([]string{"-c", writeConfig(t, "tiers.yaml", "loyalty_tiers:\n  - {name: SILVER, min_accrual: 100, multiplier: 1.2}\n"), "-tier-recalc-at", "3am"})
+	assert.ErrorContains(t, err, "must start at 0")
+	assert.ErrorContains(t, err, "tier_recalc_at")
+
+	_, err = LoadConfig([]string{"-r", "accrual:8080", "-trace", "jaeger"})
+	assert.ErrorContains(t, err, "accrual_address")
+	assert.ErrorContains(t, err, "trace_exporter")
+}
+
+func TestMasked(t *testing.T) {
+	f := Flags{FlagDBAddr: "postgres://user:secret@db:5432/gophermart", FlagJWTSecret: "jwt"}
+	masked := f.Masked()
+	assert.Equal(t, "postgres://user:xxxxx@db:5432/gophermart", masked.FlagDBAddr)
+	assert.Equal(t, MaskedValue, masked.FlagJWTSecret)
+	assert.Equal(t, "host=db password=xxxxx", maskDSN("host=db password=secret"))
+}
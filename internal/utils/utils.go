@@ -4,22 +4,151 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"flag"
 	"log"
-
-	"github.com/caarlos0/env"
+	"os"
+	"strconv"
+	"time"
 )
 
+// Flags - итоговая конфигурация сервиса. Теги yaml задают ключи
+// файла конфигурации (YAML или JSON)
 type Flags struct {
-	FlagAddr        string
-	FlagDBAddr      string
-	FlagAccrualAddr string
+	FlagConfigPath  string `yaml:"-"`
+	FlagAddr        string `yaml:"address"`
+	FlagDBAddr      string `yaml:"database_uri"`
+	FlagAccrualAddr string `yaml:"accrual_address"`
+	FlagWSMaxConns  int    `yaml:"ws_max_conns"`
+	FlagDevMode     bool   `yaml:"dev"`
+	FlagGRPCAddr    string `yaml:"grpc_address"`
+	// трассировка: none, stdout, file или otlp
+	FlagTraceExporter string `yaml:"trace_exporter"`
+	FlagTraceEndpoint string `yaml:"trace_endpoint"`
+	FlagTraceFile     string `yaml:"trace_file"`
+	// журналирование: уровень и формат (json или console)
+	FlagLogLevel  string `yaml:"log_level"`
+	FlagLogFormat string `yaml:"log_format"`
+	// сколько ждать после провала готовности перед остановкой сервера
+	FlagShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// автоматический выключатель клиента системы расчета
+	FlagAccrualBreakerFailures int           `yaml:"accrual_breaker_failures"`
+	FlagAccrualBreakerTimeout  time.Duration `yaml:"accrual_breaker_timeout"`
+	FlagAccrualBreakerProbes   int           `yaml:"accrual_breaker_probes"`
+	// таймаут одного запроса к системе расчета
+	FlagAccrualTimeout time.Duration `yaml:"accrual_timeout"`
+	// период опроса системы расчета и доставки вебхуков
+	FlagPollInterval time.Duration `yaml:"poll_interval"`
+	// ключ подписи JWT-токенов
+	FlagJWTSecret string `yaml:"jwt_secret"`
+	// TLS: сертификат и ключ сервера, CA клиентских сертификатов
+	// партнеров и период проверки файлов сертификата
+	FlagTLSCert           string        `yaml:"tls_cert"`
+	FlagTLSKey            string        `yaml:"tls_key"`
+	FlagTLSClientCA       string        `yaml:"tls_client_ca"`
+	FlagTLSReloadInterval time.Duration `yaml:"tls_reload_interval"`
+	// таймауты http.Server
+	FlagReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	FlagReadTimeout       time.Duration `yaml:"read_timeout"`
+	FlagWriteTimeout      time.Duration `yaml:"write_timeout"`
+	FlagIdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// дедлайн обработки запроса по умолчанию и по маршрутам
+	// ("POST /api/user/orders/batch": 30s), таблица задается только файлом
+	FlagRequestTimeout time.Duration            `yaml:"request_timeout"`
+	FlagRouteTimeouts  map[string]time.Duration `yaml:"route_timeouts"`
+	// ограничение частоты запросов на пользователя (или IP) по умолчанию
+	// и по маршрутам, таблица задается только файлом
+	FlagRateLimit  RateLimit            `yaml:"rate_limit"`
+	FlagRateLimits map[string]RateLimit `yaml:"rate_limits"`
+	// сгорание баллов: срок в месяцах (0 - не сгорают), горизонт
+	// "скоро сгорят" в балансе и период задачи сгорания
+	FlagPointsExpiryMonths   int           `yaml:"points_expiry_months"`
+	FlagPointsExpiringWindow time.Duration `yaml:"points_expiring_window"`
+	FlagPointsExpiryInterval time.Duration `yaml:"points_expiry_interval"`
+	// уровни программы лояльности (только файлом, по умолчанию
+	// loyalty.Default) и время ночного пересчета уровней, ЧЧ:ММ
+	FlagLoyaltyTiers []LoyaltyTier `yaml:"loyalty_tiers"`
+	FlagTierRecalcAt string        `yaml:"tier_recalc_at"`
+	// переводы баллов: лимит за сутки, сумма, от которой нужен ввод
+	// пароля, время на подтверждение и удержание полученных баллов
+	FlagTransferDailyLimit  float64       `yaml:"transfer_daily_limit"`
+	FlagTransferConfirmFrom float64       `yaml:"transfer_confirm_from"`
+	FlagTransferConfirmTTL  time.Duration `yaml:"transfer_confirm_ttl"`
+	FlagTransferHold        time.Duration `yaml:"transfer_hold"`
+	// логины администраторов и партнеров и окно, в течение которого
+	// пользователь может сам отменить списание
+	FlagAdminLogins            []string      `yaml:"admin_logins"`
+	FlagPartnerLogins          []string      `yaml:"partner_logins"`
+	FlagWithdrawalCancelWindow time.Duration `yaml:"withdrawal_cancel_window"`
+	// сверка начисленных заказов с системой расчета на случай возврата:
+	// сколько после начисления сверять (0 - не сверять) и как часто
+	FlagAccrualRecheckWindow   time.Duration `yaml:"accrual_recheck_window"`
+	FlagAccrualRecheckInterval time.Duration `yaml:"accrual_recheck_interval"`
+	// резервы баллов под списание: срок действия и период снятия просроченных
+	FlagHoldTTL           time.Duration `yaml:"hold_ttl"`
+	FlagHoldSweepInterval time.Duration `yaml:"hold_sweep_interval"`
+}
+
+// LoyaltyTier - уровень, доступный с MinAccrual баллов за 12 месяцев
+type LoyaltyTier struct {
+	Name       string  `yaml:"name"`
+	MinAccrual float64 `yaml:"min_accrual"`
+	Multiplier float64 `yaml:"multiplier"`
+}
+
+// RateLimit - не больше Requests запросов за Period.
+// Нулевое число запросов отключает ограничение
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
 }
 
 type ServerENV struct {
-	Address     string `env:"RUN_ADDRESS"`
-	DBAddress   string `env:"DATABASE_URI"`
-	AccrualAddr string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	Config          string        `env:"CONFIG"`
+	Address         string        `env:"RUN_ADDRESS"`
+	DBAddress       string        `env:"DATABASE_URI"`
+	AccrualAddr     string        `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	WSMaxConns      int           `env:"WS_MAX_CONNS"`
+	DevMode         bool          `env:"DEV_MODE"`
+	GRPCAddress     string        `env:"GRPC_ADDRESS"`
+	TraceExporter   string        `env:"TRACE_EXPORTER"`
+	TraceEndpoint   string        `env:"TRACE_ENDPOINT"`
+	TraceFile       string        `env:"TRACE_FILE"`
+	LogLevel        string        `env:"LOG_LEVEL"`
+	LogFormat       string        `env:"LOG_FORMAT"`
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY"`
+	BreakerFailures int           `env:"ACCRUAL_BREAKER_FAILURES"`
+	BreakerTimeout  time.Duration `env:"ACCRUAL_BREAKER_TIMEOUT"`
+	BreakerProbes   int           `env:"ACCRUAL_BREAKER_PROBES"`
+	AccrualTimeout  time.Duration `env:"ACCRUAL_TIMEOUT"`
+	PollInterval    time.Duration `env:"POLL_INTERVAL"`
+	JWTSecret       string        `env:"JWT_SECRET"`
+	TLSCert         string        `env:"TLS_CERT"`
+	TLSKey          string        `env:"TLS_KEY"`
+	TLSClientCA     string        `env:"TLS_CLIENT_CA"`
+	TLSReload       time.Duration `env:"TLS_RELOAD_INTERVAL"`
+	ReadHeaderTO    time.Duration `env:"READ_HEADER_TIMEOUT"`
+	ReadTO          time.Duration `env:"READ_TIMEOUT"`
+	WriteTO         time.Duration `env:"WRITE_TIMEOUT"`
+	IdleTO          time.Duration `env:"IDLE_TIMEOUT"`
+	RequestTO       time.Duration `env:"REQUEST_TIMEOUT"`
+	RateLimitReqs   int           `env:"RATE_LIMIT_REQUESTS"`
+	RateLimitPeriod time.Duration `env:"RATE_LIMIT_PERIOD"`
+	ExpiryMonths    int           `env:"POINTS_EXPIRY_MONTHS"`
+	ExpiringWindow  time.Duration `env:"POINTS_EXPIRING_WINDOW"`
+	ExpiryInterval  time.Duration `env:"POINTS_EXPIRY_INTERVAL"`
+	TierRecalcAt    string        `env:"TIER_RECALC_AT"`
+	TransferDaily   float64       `env:"TRANSFER_DAILY_LIMIT"`
+	TransferConfirm float64       `env:"TRANSFER_CONFIRM_FROM"`
+	TransferTTL     time.Duration `env:"TRANSFER_CONFIRM_TTL"`
+	TransferHold    time.Duration `env:"TRANSFER_HOLD"`
+	AdminLogins     []string      `env:"ADMIN_LOGINS" envSeparator:","`
+	PartnerLogins   []string      `env:"PARTNER_LOGINS" envSeparator:","`
+	CancelWindow    time.Duration `env:"WITHDRAWAL_CANCEL_WINDOW"`
+	RecheckWindow   time.Duration `env:"ACCRUAL_RECHECK_WINDOW"`
+	RecheckInterval time.Duration `env:"ACCRUAL_RECHECK_INTERVAL"`
+	HoldTTL         time.Duration `env:"HOLD_TTL"`
+	HoldSweep       time.Duration `env:"HOLD_SWEEP_INTERVAL"`
 }
 
 func ShaData(result string, key string) string {
@@ -35,32 +164,25 @@ func ShaData(result string, key string) string {
 	return string(sha)
 }
 
+// ParseFlagsAndENV собирает конфигурацию из аргументов командной строки,
+// файла и окружения и завершает процесс, если она некорректна
 func ParseFlagsAndENV() Flags {
-	var Flag Flags
-	flag.StringVar(&Flag.FlagAddr, "a", "localhost:8080", "address and port to run server")
-	flag.StringVar(&Flag.FlagDBAddr, "d", "", "address for db")
-	flag.StringVar(&Flag.FlagAccrualAddr, "r", "", "accrual system addr")
-	flag.Parse()
-	var envcfg ServerENV
-	err := env.Parse(&envcfg)
+	Flag, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	if len(envcfg.Address) > 0 {
-		Flag.FlagAddr = envcfg.Address
-	}
-	if len(envcfg.DBAddress) > 0 {
-		Flag.FlagDBAddr = envcfg.DBAddress
-	}
-
-	if len(envcfg.AccrualAddr) > 0 {
-		Flag.FlagAccrualAddr = envcfg.AccrualAddr
-	}
-
 	return Flag
 }
 
+// ParseOrderNumber разбирает номер заказа. Номера хранятся в BIGINT,
+// поэтому номера больше math.MaxInt64 не принимаются
+func ParseOrderNumber(value string) (uint64, error) {
+	return strconv.ParseUint(value, 10, 63)
+}
+
 func IsOrderNumberValid(number uint64) bool {
 	return (number%10+orderChecksum(number/10))%10 == 0
 }
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+)
+
+const (
+	SignatureHeader = "X-Gophermart-Signature"
+	EventHeader     = "X-Gophermart-Event"
+	DeliveryHeader  = "X-Gophermart-Delivery"
+)
+
+const (
+	// MaxAttempts - после стольких неудачных попыток событие уходит в dead letter
+	MaxAttempts = 8
+	batchSize   = 50
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// ErrForbiddenAddress - адрес вебхука ведет во внутреннюю сеть
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+const deliveryTimeout = 5 * time.Second
+
+var client = newClient()
+
+// newClient возвращает клиент, который подключается только к публичным
+// адресам. Адрес проверяется после разрешения имени, поэтому DNS,
+// сменивший ответ после регистрации, не откроет доступ во внутреннюю сеть
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// через прокси проверка адреса назначения не работает
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: deliveryTimeout, Transport: transport}
+}
+
+// isPublic - адрес не относится к loopback, частным, link-local и
+// служебным диапазонам
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// CheckURL разрешает имя хоста вебхука и возвращает ErrForbiddenAddress,
+// если хотя бы один из адресов не публичный
+func CheckURL(ctx context.Context, endpoint *url.URL) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, endpoint.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewSecret генерирует секрет для подписи событий вебхука
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign подписывает тело события секретом вебхука (HMAC-SHA256)
+func Sign(payload string, secret string) string {
+	return "sha256=" + utils.ShaData(payload, secret)
+}
+
+// Backoff возвращает задержку перед следующей попыткой доставки
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// DeliverPending отправляет партнерам события из outbox, для которых
+// подошло время очередной попытки
+func DeliverPending() {
+	ctx := context.Background()
+	deliveries, err := storage.PgxStorage.GetPendingDeliveries(storage.ST, ctx, batchSize)
+	if err != nil {
+		logger.Default().Errorw("failed to get pending webhook deliveries", "error", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		err = deliver(ctx, delivery)
+		delivery.Attempts++
+		delivery.NextAttempt = time.Now()
+		switch {
+		case err == nil:
+			delivery.State = storage.DeliveryDelivered
+			delivery.LastError = ""
+		case delivery.Attempts >= MaxAttempts:
+			delivery.State = storage.DeliveryDead
+			delivery.LastError = err.Error()
+			logger.Default().Warnw("webhook delivery dead-lettered",
+				"delivery_id", delivery.ID,
+				"event", delivery.Event,
+				"attempts", delivery.Attempts,
+				"error", err,
+			)
+		default:
+			delivery.NextAttempt = delivery.NextAttempt.Add(Backoff(delivery.Attempts))
+			delivery.LastError = err.Error()
+		}
+		// без сохраненной попытки событие будет отправлено повторно
+		if err := storage.PgxStorage.UpdateDelivery(storage.ST, ctx, delivery); err != nil {
+			logger.Default().Errorw("failed to update webhook delivery",
+				"delivery_id", delivery.ID,
+				"state", delivery.State,
+				"error", err,
+			)
+		}
+	}
+}
+
+func deliver(ctx context.Context, delivery storage.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Payload, delivery.Secret))
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
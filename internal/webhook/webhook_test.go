@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azcarot/GopherMarketProject/internal/logger"
+	mock_storage "github.com/Azcarot/GopherMarketProject/internal/mock"
+	"github.com/Azcarot/GopherMarketProject/internal/storage"
+	"github.com/Azcarot/GopherMarketProject/internal/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, baseBackoff, Backoff(1))
+	require.Equal(t, 2*baseBackoff, Backoff(2))
+	require.Equal(t, 8*baseBackoff, Backoff(4))
+	require.Equal(t, maxBackoff, Backoff(MaxAttempts*4))
+}
+
+func allowLoopback(t *testing.T) {
+	saved := client
+	client = &http.Client{Timeout: deliveryTimeout}
+	t.Cleanup(func() { client = saved })
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	allowLoopback(t)
+	payload := `{"event":"order.processed","order":"12345678903"}`
+	secret := "partner-secret"
+	var gotSignature, gotEvent string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gotSignature = req.Header.Get(SignatureHeader)
+		gotEvent = req.Header.Get(EventHeader)
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	err := deliver(context.Background(), storage.WebhookDelivery{
+		ID:          1,
+		Event:       storage.WebhookOrderProcessed,
+		Payload:     payload,
+		URL:         server.URL,
+		Secret:      secret,
+		NextAttempt: time.Now(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "sha256="+utils.ShaData(payload, secret), gotSignature)
+	require.Equal(t, storage.WebhookOrderProcessed, gotEvent)
+}
+
+func TestDeliverFailsOnErrorStatus(t *testing.T) {
+	allowLoopback(t)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	err := deliver(context.Background(), storage.WebhookDelivery{URL: server.URL})
+	require.Error(t, err)
+}
+
+func TestDeliverRejectsInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("delivery reached a loopback address")
+	}))
+	defer server.Close()
+	err := deliver(context.Background(), storage.WebhookDelivery{URL: server.URL})
+	require.ErrorIs(t, err, ErrForbiddenAddress)
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		endpoint, err := url.Parse(raw)
+		require.NoError(t, err)
+		require.ErrorIs(t, CheckURL(context.Background(), endpoint), ErrForbiddenAddress, raw)
+	}
+	endpoint, err := url.Parse("https://93.184.216.34/hook")
+	require.NoError(t, err)
+	require.NoError(t, CheckURL(context.Background(), endpoint))
+}
+
+func TestDeliverPendingLogsUpdateFailure(t *testing.T) {
+	allowLoopback(t)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	core, logs := observer.New(zap.InfoLevel)
+	logger.SetDefault(zap.New(core))
+	defer logger.SetDefault(zap.NewNop())
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := mock_storage.NewMockPgxStorage(ctrl)
+	storage.ST = mock
+	mock.EXPECT().GetPendingDeliveries(gomock.Any(), batchSize).
+		Return([]storage.WebhookDelivery{{ID: 7, URL: server.URL}}, nil)
+	mock.EXPECT().UpdateDelivery(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, delivery storage.WebhookDelivery) error {
+			require.Equal(t, storage.DeliveryDelivered, delivery.State)
+			return errors.New("connection reset")
+		})
+
+	DeliverPending()
+
+	entries := logs.FilterMessage("failed to update webhook delivery").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(7), entries[0].ContextMap()["delivery_id"])
+}